@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"greenlight.darkhanomirbay/internal/data"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+)
+
+// artworkKind is one of the images a movie can have. Its name is the form field it is
+// uploaded in, the prefix its objects are stored under and what messages call it.
+type artworkKind struct {
+	name string
+	// widths are the widths in pixels of the thumbnails generated for every upload.
+	widths []int
+	// fields returns the key and artwork fields of movie that hold this kind.
+	fields func(movie *data.Movie) (*string, *data.Artwork)
+	// save stores the fields of this kind of movie.
+	save func(movies data.MovieRepository, ctx context.Context, movie *data.Movie) error
+}
+
+var (
+	posterArtwork = artworkKind{
+		name:   "poster",
+		widths: []int{92, 185, 500},
+		fields: func(movie *data.Movie) (*string, *data.Artwork) { return &movie.PosterKey, &movie.Poster },
+		save:   data.MovieRepository.SetPoster,
+	}
+	backdropArtwork = artworkKind{
+		name:   "backdrop",
+		widths: []int{300, 780, 1280},
+		fields: func(movie *data.Movie) (*string, *data.Artwork) { return &movie.BackdropKey, &movie.Backdrop },
+		save:   data.MovieRepository.SetBackdrop,
+	}
+)
+
+// artworkTypes maps the sniffed content types accepted for artwork to the file extension
+// the original is stored with.
+var artworkTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+const maxArtworkDimension = 8000
+
+// uploadArtworkHandler returns the handler that replaces the artwork of the given kind
+// of a movie with an uploaded image.
+func (app *application) uploadArtworkHandler(kind artworkKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		app.uploadArtwork(w, r, kind)
+	}
+}
+
+func (app *application) uploadArtwork(w http.ResponseWriter, r *http.Request, kind artworkKind) {
+	movie, ok := app.readMovie(w, r)
+	if !ok {
+		return
+	}
+	original, err := app.readArtwork(w, r, kind)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Trust the bytes rather than the Content-Type the client claimed for the part.
+	contentType := http.DetectContentType(original)
+	ext, ok := artworkTypes[contentType]
+	if !ok {
+		app.unsupportedMediaTypeResponse(w, r, "image/jpeg", "image/png", "image/webp")
+		return
+	}
+	// Check the dimensions before decoding, so that a small file can't make us allocate
+	// a huge image.
+	config, _, err := image.DecodeConfig(bytes.NewReader(original))
+	if err != nil {
+		app.badRequestResponse(w, r, errors.New(kind.name+" is not a valid image"))
+		return
+	}
+	if config.Width < 1 || config.Height < 1 || config.Width > maxArtworkDimension || config.Height > maxArtworkDimension {
+		app.badRequestResponse(w, r, fmt.Errorf("%s dimensions mustnt exceed %dx%d pixels", kind.name, maxArtworkDimension, maxArtworkDimension))
+		return
+	}
+	img, _, err := image.Decode(bytes.NewReader(original))
+	if err != nil {
+		app.badRequestResponse(w, r, errors.New(kind.name+" is not a valid image"))
+		return
+	}
+
+	objects := map[string][]byte{"original" + ext: original}
+	for _, width := range kind.widths {
+		var buf bytes.Buffer
+		err = jpeg.Encode(&buf, thumbnail(img, width), &jpeg.Options{Quality: 85})
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		objects["w"+strconv.Itoa(width)+".jpg"] = buf.Bytes()
+	}
+
+	// Every upload goes under a fresh prefix, so caches never serve a stale image for
+	// an artwork URL.
+	suffix := make([]byte, 8)
+	_, err = rand.Read(suffix)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	key := fmt.Sprintf("%ss/%d/%s", kind.name, movie.ID, hex.EncodeToString(suffix))
+	artwork := make(data.Artwork, len(objects))
+	for name, content := range objects {
+		objectType := "image/jpeg"
+		if name == "original"+ext {
+			objectType = contentType
+		}
+		err = app.blobs.Put(r.Context(), key+"/"+name, bytes.NewReader(content), int64(len(content)), objectType)
+		if err != nil {
+			app.deleteArtwork(key, artwork)
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		artwork[name[:len(name)-len(path.Ext(name))]] = app.blobs.URL(key + "/" + name)
+	}
+
+	keyField, artworkField := kind.fields(movie)
+	oldKey, oldArtwork := *keyField, *artworkField
+	*keyField, *artworkField = key, artwork
+	err = kind.save(app.models.Movies, r.Context(), movie)
+	if err != nil {
+		app.deleteArtwork(key, artwork)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if oldKey != "" {
+		app.background(func() {
+			app.deleteArtwork(oldKey, oldArtwork)
+		})
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteArtworkHandler returns the handler that removes the artwork of the given kind
+// from a movie.
+func (app *application) deleteArtworkHandler(kind artworkKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		app.deleteArtworkOf(w, r, kind)
+	}
+}
+
+func (app *application) deleteArtworkOf(w http.ResponseWriter, r *http.Request, kind artworkKind) {
+	movie, ok := app.readMovie(w, r)
+	if !ok {
+		return
+	}
+	keyField, artworkField := kind.fields(movie)
+	if *keyField == "" {
+		app.notFoundResponse(w, r)
+		return
+	}
+	oldKey, oldArtwork := *keyField, *artworkField
+	*keyField, *artworkField = "", nil
+	err := kind.save(app.models.Movies, r.Context(), movie)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.background(func() {
+		app.deleteArtwork(oldKey, oldArtwork)
+	})
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": kind.name + " successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readArtwork returns the contents of the file named after kind in a multipart/form-data
+// request body, holding at most posters.maxBytes of it in memory.
+func (app *application) readArtwork(w http.ResponseWriter, r *http.Request, kind artworkKind) ([]byte, error) {
+	maxBytes := app.config.posters.maxBytes
+	// Leave some room for the multipart boundaries and part headers.
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+64*1024)
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, errors.New("body must be multipart/form-data")
+	}
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			switch {
+			case errors.Is(err, io.EOF):
+				return nil, fmt.Errorf("body must contain a %q file", kind.name)
+			case errors.As(err, &maxBytesError):
+				return nil, fmt.Errorf("%s mustnt be larger than %d bytes", kind.name, maxBytes)
+			default:
+				return nil, err
+			}
+		}
+		if part.FormName() != kind.name {
+			continue
+		}
+		content, err := io.ReadAll(io.LimitReader(part, maxBytes+1))
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) {
+				return nil, fmt.Errorf("%s mustnt be larger than %d bytes", kind.name, maxBytes)
+			}
+			return nil, err
+		}
+		if int64(len(content)) > maxBytes {
+			return nil, fmt.Errorf("%s mustnt be larger than %d bytes", kind.name, maxBytes)
+		}
+		if len(content) == 0 {
+			return nil, errors.New(kind.name + " must not be empty")
+		}
+		return content, nil
+	}
+}
+
+// deleteArtwork removes the stored objects of a poster or backdrop. Failures only leave
+// orphaned objects behind, so they are logged rather than returned.
+func (app *application) deleteArtwork(key string, artwork data.Artwork) {
+	for _, url := range artwork {
+		err := app.blobs.Delete(context.Background(), key+"/"+path.Base(url))
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"artwork_key": key})
+		}
+	}
+}
+
+// deletePurgedArtwork removes the stored objects of the poster and backdrop of a purged
+// movie.
+func (app *application) deletePurgedArtwork(purged data.PurgedMovie) {
+	if purged.PosterKey != "" {
+		app.deleteArtwork(purged.PosterKey, purged.Poster)
+	}
+	if purged.BackdropKey != "" {
+		app.deleteArtwork(purged.BackdropKey, purged.Backdrop)
+	}
+}
+
+// serveBlobHandler serves the objects of the local blob store. Directory listings are
+// not served.
+func (app *application) serveBlobHandler(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	name := filepath.Join(app.config.blob.localDir, filepath.FromSlash(path.Clean("/"+params.ByName("filepath"))))
+
+	info, err := os.Stat(name)
+	if err != nil || info.IsDir() {
+		app.notFoundResponse(w, r)
+		return
+	}
+	http.ServeFile(w, r, name)
+}
+
+// thumbnail scales img down to the given width, keeping its aspect ratio. Images that
+// are already narrower keep their size. Transparent areas are flattened onto white, as
+// thumbnails are encoded as JPEG.
+func thumbnail(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() < width {
+		width = bounds.Dx()
+	}
+	height := bounds.Dy() * width / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+	return dst
+}
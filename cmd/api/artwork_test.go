@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"greenlight.darkhanomirbay/internal/data"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// addArtwork stores artwork of the given kind for the movie directly, without going
+// through the image processing of the upload handler, and returns the names of its files.
+func addArtwork(t *testing.T, app *application, kind artworkKind, id int64) []string {
+	t.Helper()
+	ctx := context.Background()
+	movie, err := app.models.Movies.Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyField, artworkField := kind.fields(movie)
+	*keyField, *artworkField = fmt.Sprintf("movies/%d/%s", id, kind.name), data.Artwork{}
+	var files []string
+	for _, name := range []string{"original.jpg", "w185.jpg"} {
+		key := *keyField + "/" + name
+		err := app.blobs.Put(ctx, key, strings.NewReader("jpeg"), 4, "image/jpeg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		(*artworkField)[strings.TrimSuffix(name, ".jpg")] = app.blobs.URL(key)
+		files = append(files, filepath.Join(app.config.blob.localDir, filepath.FromSlash(key)))
+	}
+	err = kind.save(app.models.Movies, ctx, movie)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// addAllArtwork adds both a poster and a backdrop to the movie and returns the names of
+// their files.
+func addAllArtwork(t *testing.T, app *application, id int64) []string {
+	t.Helper()
+	return append(addArtwork(t, app, posterArtwork, id), addArtwork(t, app, backdropArtwork, id)...)
+}
+
+// checkFiles fails the test unless each of the files exists as wanted.
+func checkFiles(t *testing.T, files []string, exist bool) {
+	t.Helper()
+	for _, name := range files {
+		_, err := os.Stat(name)
+		if got := err == nil; got != exist {
+			t.Errorf("got %s existing %t, want %t", name, got, exist)
+		}
+	}
+}
+
+func TestArtworkDeletedWithMovie(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+	token := ts.newUser(t, "writer@example.com", "movies:write", "movies:purge")
+
+	newMovie := func(title string) int64 {
+		resp := ts.mustDo(t, http.StatusCreated, http.MethodPost, "/v1/movies", token, map[string]any{
+			"title":   title,
+			"year":    2016,
+			"runtime": 107,
+			"genres":  []string{"animation"},
+		})
+		return int64(field[float64](t, resp.body, "movie", "id"))
+	}
+
+	t.Run("purge", func(t *testing.T) {
+		id := newMovie("Moana")
+		files := addAllArtwork(t, app, id)
+		ts.mustDo(t, http.StatusOK, http.MethodDelete, moviePath(id), token, nil)
+		checkFiles(t, files, true)
+
+		ts.mustDo(t, http.StatusOK, http.MethodPost, moviePath(id)+"/purge", token, nil)
+		app.wg.Wait()
+		checkFiles(t, files, false)
+	})
+
+	t.Run("purge trash", func(t *testing.T) {
+		id := newMovie("Zootopia")
+		files := addAllArtwork(t, app, id)
+		ts.mustDo(t, http.StatusOK, http.MethodDelete, moviePath(id), token, nil)
+
+		app.config.trash.retention = -time.Minute
+		err := app.purgeTrash(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkFiles(t, files, false)
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		target, source := newMovie("Frozen"), newMovie("Frozen II")
+		targetFiles, sourceFiles := addAllArtwork(t, app, target), addAllArtwork(t, app, source)
+		ts.mustDo(t, http.StatusOK, http.MethodPost, moviePath(target)+"/merge", token, map[string]any{"source_id": source})
+		app.wg.Wait()
+		checkFiles(t, targetFiles, true)
+		checkFiles(t, sourceFiles, false)
+	})
+
+	t.Run("merge into a movie without artwork", func(t *testing.T) {
+		target, source := newMovie("Encanto"), newMovie("Encanto 2")
+		files := addAllArtwork(t, app, source)
+		resp := ts.mustDo(t, http.StatusOK, http.MethodPost, moviePath(target)+"/merge", token, map[string]any{"source_id": source})
+		app.wg.Wait()
+		checkFiles(t, files, true)
+		for _, name := range []string{"poster", "backdrop"} {
+			if got := field[map[string]any](t, resp.body, "movie", name); len(got) != 2 {
+				t.Errorf("got %s %v, want the source's", name, got)
+			}
+		}
+	})
+}
+
+func TestUploadBackdrop(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+	token := ts.newUser(t, "writer@example.com", "movies:write")
+
+	resp := ts.mustDo(t, http.StatusCreated, http.MethodPost, "/v1/movies", token, map[string]any{
+		"title":   "Moana",
+		"year":    2016,
+		"runtime": 107,
+		"genres":  []string{"animation"},
+	})
+	id := int64(field[float64](t, resp.body, "movie", "id"))
+
+	var img bytes.Buffer
+	err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 1600, 900)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("backdrop", "moana.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(img.Bytes())
+	mw.Close()
+
+	req := ts.newRequest(t, http.MethodPut, moviePath(id)+"/backdrop", token, nil)
+	req.Body = io.NopCloser(&body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	resp = ts.send(t, req)
+	if resp.status != http.StatusOK {
+		t.Fatalf("got status %d, want 200; body %v", resp.status, resp.body)
+	}
+	backdrop := field[map[string]any](t, resp.body, "movie", "backdrop")
+	var files []string
+	for _, name := range []string{"original", "w300", "w780", "w1280"} {
+		url, ok := backdrop[name].(string)
+		if !ok {
+			t.Fatalf("got backdrop %v, want an original and three thumbnails", backdrop)
+		}
+		if !strings.Contains(url, fmt.Sprintf("/backdrops/%d/", id)) {
+			t.Errorf("got %s URL %s, want one under backdrops/%d", name, url, id)
+		}
+		key := strings.TrimPrefix(url[strings.Index(url, "/backdrops/"):], "/")
+		files = append(files, filepath.Join(app.config.blob.localDir, filepath.FromSlash(key)))
+	}
+	if _, ok := resp.body["movie"].(map[string]any)["poster"]; ok {
+		t.Errorf("the backdrop upload set a poster: %v", resp.body)
+	}
+	checkFiles(t, files, true)
+
+	ts.mustDo(t, http.StatusOK, http.MethodDelete, moviePath(id)+"/backdrop", token, nil)
+	app.wg.Wait()
+	checkFiles(t, files, false)
+	ts.mustDo(t, http.StatusNotFound, http.MethodDelete, moviePath(id)+"/backdrop", token, nil)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"greenlight.darkhanomirbay/internal/data"
+	"greenlight.darkhanomirbay/internal/validator"
+	"net/http"
+)
+
+func (app *application) createCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        string  `json:"name"`
+		Description string  `json:"description"`
+		MovieIDs    []int64 `json:"movie_ids"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	collection := &data.Collection{
+		Name:        input.Name,
+		Description: input.Description,
+		MovieIDs:    input.MovieIDs,
+	}
+	if collection.MovieIDs == nil {
+		collection.MovieIDs = []int64{}
+	}
+	v := validator.New()
+	if data.ValidateCollection(v, collection); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Collections.Insert(r.Context(), collection)
+	if err != nil {
+		app.collectionErrorResponse(w, r, v, err)
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/collections/%d", collection.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"collection": collection}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showCollectionHandler returns the collection together with its movies in order.
+func (app *application) showCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.readCollection(w, r)
+	if !ok {
+		return
+	}
+	movies, err := app.models.Collections.GetMovies(r.Context(), collection.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	hideEditorFields(app.contextGetUser(r), collection)
+	hideEditorFields(app.contextGetUser(r), movies...)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"collection": collection, "movies": movies}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateCollectionHandler changes the given fields of the collection. A movie_ids list
+// replaces the movies of the collection and sets their order.
+func (app *application) updateCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.readCollection(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+		MovieIDs    []int64 `json:"movie_ids"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Name != nil {
+		collection.Name = *input.Name
+	}
+	if input.Description != nil {
+		collection.Description = *input.Description
+	}
+	if input.MovieIDs != nil {
+		collection.MovieIDs = input.MovieIDs
+	}
+	v := validator.New()
+	if data.ValidateCollection(v, collection); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Collections.Update(r.Context(), collection, input.MovieIDs != nil)
+	if err != nil {
+		app.collectionErrorResponse(w, r, v, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"collection": collection}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Collections.Delete(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "collection successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name    string
+		Filters data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Name = app.readString(qs, "name", "")
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortSafeList = []string{"id", "name", "-id", "-name"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	collections, metadata, err := app.models.Collections.GetAll(r.Context(), input.Name, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	hideEditorFields(app.contextGetUser(r), collections...)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"collections": collections, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readCollection loads the collection named by the id URL parameter. If it can't, the
+// error response has already been sent and ok is false.
+func (app *application) readCollection(w http.ResponseWriter, r *http.Request) (*data.Collection, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	collection, err := app.models.Collections.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return collection, true
+}
+
+// collectionErrorResponse reports an error from saving a collection.
+func (app *application) collectionErrorResponse(w http.ResponseWriter, r *http.Request, v *validator.Validator, err error) {
+	switch {
+	case errors.Is(err, data.ErrEditConflict):
+		app.editConflictResponse(w, r)
+	case errors.Is(err, data.ErrUnknownMovie):
+		v.AddError("movie_ids", "must only contain existing movies")
+		app.failedValidationResponse(w, r, v.Errors)
+	case errors.Is(err, data.ErrMovieInAnotherCollection):
+		v.AddError("movie_ids", "must not contain movies that belong to another collection")
+		app.failedValidationResponse(w, r, v.Errors)
+	case errors.Is(err, data.ErrTrashedMovie):
+		v.AddError("movie_ids", "must not add movies that are in the trash")
+		app.failedValidationResponse(w, r, v.Errors)
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
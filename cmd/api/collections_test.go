@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestCollectionKeepsTrashedMovies(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+	token := ts.newUser(t, "writer@example.com", "movies:write")
+
+	var ids []any
+	for _, title := range []string{"The Fellowship of the Ring", "The Two Towers", "The Return of the King"} {
+		resp := ts.mustDo(t, http.StatusCreated, http.MethodPost, "/v1/movies", token, map[string]any{
+			"title":   title,
+			"year":    2001,
+			"runtime": 178,
+			"genres":  []string{"fantasy"},
+		})
+		ids = append(ids, field[float64](t, resp.body, "movie", "id"))
+	}
+	resp := ts.mustDo(t, http.StatusCreated, http.MethodPost, "/v1/collections", token, map[string]any{
+		"name":      "The Lord of the Rings",
+		"movie_ids": ids,
+	})
+	path := fmt.Sprintf("/v1/collections/%d", int64(field[float64](t, resp.body, "collection", "id")))
+
+	middle := moviePath(int64(ids[1].(float64)))
+	ts.mustDo(t, http.StatusOK, http.MethodDelete, middle, token, nil)
+	resp = ts.mustDo(t, http.StatusOK, http.MethodPatch, path, token, map[string]any{"name": "Middle-earth"})
+	if got, want := field[[]any](t, resp.body, "collection", "movie_ids"), []any{ids[0], ids[2]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got movie_ids %v while the movie is in the trash, want %v", got, want)
+	}
+
+	// The movie comes back in its old place.
+	ts.mustDo(t, http.StatusOK, http.MethodPost, middle+"/restore", token, nil)
+	resp = ts.mustDo(t, http.StatusOK, http.MethodGet, path, token, nil)
+	if got := field[[]any](t, resp.body, "collection", "movie_ids"); !reflect.DeepEqual(got, ids) {
+		t.Errorf("got movie_ids %v after the restore, want %v", got, ids)
+	}
+	if got := field[string](t, resp.body, "collection", "name"); got != "Middle-earth" {
+		t.Errorf("got name %q, want Middle-earth", got)
+	}
+
+	// Listing the movies replaces them, and leaves out a trashed movie that isn't listed.
+	ts.mustDo(t, http.StatusOK, http.MethodDelete, middle, token, nil)
+	ts.mustDo(t, http.StatusOK, http.MethodPatch, path, token, map[string]any{"movie_ids": []any{ids[2], ids[0]}})
+	ts.mustDo(t, http.StatusOK, http.MethodPost, middle+"/restore", token, nil)
+	resp = ts.mustDo(t, http.StatusOK, http.MethodGet, path, token, nil)
+	if got, want := field[[]any](t, resp.body, "collection", "movie_ids"), []any{ids[2], ids[0]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got movie_ids %v, want %v", got, want)
+	}
+}
+
+func TestCollectionRejectsNewTrashedMovies(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+	token := ts.newUser(t, "writer@example.com", "movies:write")
+
+	var ids []any
+	for _, title := range []string{"Toy Story", "Toy Story 2", "Toy Story 3"} {
+		resp := ts.mustDo(t, http.StatusCreated, http.MethodPost, "/v1/movies", token, map[string]any{
+			"title":   title,
+			"year":    1995,
+			"runtime": 81,
+			"genres":  []string{"animation"},
+		})
+		ids = append(ids, field[float64](t, resp.body, "movie", "id"))
+	}
+	trashed := ids[2]
+	ts.mustDo(t, http.StatusOK, http.MethodDelete, moviePath(int64(trashed.(float64))), token, nil)
+
+	resp := ts.mustDo(t, http.StatusUnprocessableEntity, http.MethodPost, "/v1/collections", token, map[string]any{
+		"name":      "Toy Story",
+		"movie_ids": ids,
+	})
+	if got := field[string](t, resp.body, "error", "movie_ids"); got != "must not add movies that are in the trash" {
+		t.Errorf("got error %q", got)
+	}
+
+	resp = ts.mustDo(t, http.StatusCreated, http.MethodPost, "/v1/collections", token, map[string]any{
+		"name":      "Toy Story",
+		"movie_ids": ids[:2],
+	})
+	path := fmt.Sprintf("/v1/collections/%d", int64(field[float64](t, resp.body, "collection", "id")))
+	ts.mustDo(t, http.StatusUnprocessableEntity, http.MethodPatch, path, token, map[string]any{"movie_ids": ids})
+
+	// A member that went to the trash may still be listed.
+	member := ids[1]
+	ts.mustDo(t, http.StatusOK, http.MethodDelete, moviePath(int64(member.(float64))), token, nil)
+	ts.mustDo(t, http.StatusOK, http.MethodPatch, path, token, map[string]any{"movie_ids": []any{member, ids[0]}})
+	ts.mustDo(t, http.StatusOK, http.MethodPost, moviePath(int64(member.(float64)))+"/restore", token, nil)
+	resp = ts.mustDo(t, http.StatusOK, http.MethodGet, path, token, nil)
+	if got, want := field[[]any](t, resp.body, "collection", "movie_ids"), []any{member, ids[0]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got movie_ids %v, want %v", got, want)
+	}
+}
@@ -1,15 +1,30 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"greenlight.darkhanomirbay/internal/data"
 	"net/http"
+	"strings"
 )
 
+// statusClientClosedRequest is the non-standard status nginx uses for requests the client
+// gave up on before the response was ready.
+const statusClientClosedRequest = 499
+
 func (app *application) logError(r *http.Request, err error) {
-	app.logger.PrintError(err, map[string]string{"request_method": r.Method, "request_url": r.URL.String()})
+	properties := map[string]string{"request_method": r.Method, "request_url": r.URL.String()}
+	if id := app.contextGetRequestID(r); id != "" {
+		properties["request_id"] = id
+	}
+	app.logger.PrintErrorContext(r.Context(), err, properties)
 }
 func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message any) {
 	env := envelope{"error": message}
+	if id := app.contextGetRequestID(r); id != "" {
+		env["request_id"] = id
+	}
 
 	err := app.writeJSON(w, status, env, nil)
 	if err != nil {
@@ -19,18 +34,42 @@ func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, st
 
 }
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	if data.QueryCanceled(err) {
+		app.canceledResponse(w, r, err)
+		return
+	}
 	app.logError(r, err)
 	message := "the server encountered a problem and could not process your request"
 	app.errorResponse(w, r, http.StatusInternalServerError, message)
 
 }
+
+// canceledResponse reports database work that was abandoned. If the request itself was
+// cancelled, either the client went away or the server is shutting down; otherwise a
+// query ran out of time.
+func (app *application) canceledResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(r.Context().Err(), context.Canceled) && app.shuttingDown.Load():
+		w.Header().Set("Connection", "close")
+		message := "the server is shutting down, please try again"
+		app.errorResponse(w, r, http.StatusServiceUnavailable, message)
+	case errors.Is(r.Context().Err(), context.Canceled):
+		// Nobody is left to read the response, but the status still shows up in the
+		// access log and metrics.
+		app.errorResponse(w, r, statusClientClosedRequest, "client closed request")
+	default:
+		app.logError(r, err)
+		message := "the server took too long to process your request"
+		app.errorResponse(w, r, http.StatusGatewayTimeout, message)
+	}
+}
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
 	message := "the requested resource could not be found"
-	app.errorResponse(w, r, http.StatusInternalServerError, message)
+	app.errorResponse(w, r, http.StatusNotFound, message)
 }
 func (app *application) methodNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
 	message := fmt.Sprintf("the %s method is not supported for this resource", r.Method)
-	app.errorResponse(w, r, http.StatusInternalServerError, message)
+	app.errorResponse(w, r, http.StatusMethodNotAllowed, message)
 }
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
@@ -67,3 +106,21 @@ func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Requ
 	message := "your user account doesn't have the necessary permissions to access this resource"
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request, mediaTypes ...string) {
+	message := fmt.Sprintf("the request body must be one of the following media types: %s", strings.Join(mediaTypes, ", "))
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, message)
+}
+func (app *application) duplicateMovieResponse(w http.ResponseWriter, r *http.Request, duplicates []*data.Movie) {
+	env := envelope{
+		"error":      "the movie looks like a duplicate of an existing one, resend with force=true to create it anyway",
+		"duplicates": duplicates,
+	}
+	if id := app.contextGetRequestID(r); id != "" {
+		env["request_id"] = id
+	}
+	err := app.writeJSON(w, http.StatusConflict, env, nil)
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(500)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"greenlight.darkhanomirbay/internal/data"
+	"greenlight.darkhanomirbay/internal/validator"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	exportBatchSize  = 500
+	exportFlushEvery = 100
+)
+
+func (app *application) exportMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		movieSearch
+		Format string
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.movieSearch = app.readMovieSearch(qs, v)
+	input.Format = app.readString(qs, "format", "ndjson")
+
+	v.Check(validator.PermittedValue(input.Format, "ndjson", "csv", "json"), "format", "must be one of ndjson, csv or json")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The server WriteTimeout is sized for ordinary requests, so lift it for the
+	// duration of the export. Client disconnects are still noticed via the request
+	// context.
+	rc := http.NewResponseController(w)
+	err := rc.SetWriteDeadline(time.Time{})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// CSV runtimes are plain minutes unless another format was asked for.
+	runtimeFormat, csvRuntimeFormat := responseRuntimeFormat(w), data.RuntimeFormatMinutes
+	if runtimeFormat != data.RuntimeFormatMins {
+		csvRuntimeFormat = runtimeFormat
+	}
+
+	out := &countingWriter{w: w}
+	buf := bufio.NewWriter(out)
+	var (
+		write  func(*data.Movie) error
+		finish func() error
+	)
+	switch input.Format {
+	case "ndjson":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		write = func(movie *data.Movie) error {
+			movie.SetRuntimeFormat(runtimeFormat)
+			js, err := json.Marshal(movie)
+			if err != nil {
+				return err
+			}
+			buf.Write(js)
+			return buf.WriteByte('\n')
+		}
+		finish = func() error { return nil }
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		cw := csv.NewWriter(buf)
+		err = cw.Write([]string{"id", "title", "year", "runtime", "genres", "version"})
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		write = func(movie *data.Movie) error {
+			return cw.Write([]string{
+				strconv.FormatInt(movie.ID, 10),
+				movie.Title,
+				strconv.FormatInt(int64(movie.Year), 10),
+				movie.Runtime.Format(csvRuntimeFormat),
+				strings.Join(movie.Genres, ","),
+				strconv.FormatInt(int64(movie.Version), 10),
+			})
+		}
+		finish = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		buf.WriteString(`{"movies":[`)
+		first := true
+		write = func(movie *data.Movie) error {
+			movie.SetRuntimeFormat(runtimeFormat)
+			js, err := json.Marshal(movie)
+			if err != nil {
+				return err
+			}
+			if !first {
+				buf.WriteByte(',')
+			}
+			first = false
+			buf.Write(js)
+			return nil
+		}
+		finish = func() error {
+			_, err := buf.WriteString("]}\n")
+			return err
+		}
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="movies.`+input.Format+`"`)
+
+	user := app.contextGetUser(r)
+	count := 0
+	err = app.models.Movies.Export(r.Context(), input.Title, input.Genres, input.ExternalIDs, input.OriginalLanguage, input.Certifications, exportBatchSize, func(movie *data.Movie) error {
+		hideEditorFields(user, movie)
+		err := write(movie)
+		if err != nil {
+			return err
+		}
+		count++
+		if count%exportFlushEvery == 0 {
+			if err := buf.Flush(); err != nil {
+				return err
+			}
+			return rc.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = finish()
+	}
+	if err == nil {
+		err = buf.Flush()
+	}
+	if err != nil {
+		// Nothing can be reported to a client that has gone away.
+		if errors.Is(err, context.Canceled) || r.Context().Err() != nil {
+			return
+		}
+		// If nothing has been sent yet the client can still get a proper error
+		// response, otherwise the connection is closed mid-stream so that the
+		// truncated export isn't mistaken for a complete one.
+		if out.n == 0 {
+			w.Header().Del("Content-Disposition")
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.logError(r, err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// countingWriter records how many bytes have been passed on to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"greenlight.darkhanomirbay/internal/data"
+	"greenlight.darkhanomirbay/internal/jsonlog"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// failingExport is a movie model whose exports fail after passing on count movies.
+type failingExport struct {
+	data.MovieRepository
+	count int
+}
+
+func (m failingExport) Export(ctx context.Context, title string, genres []string, externalIDs data.ExternalIDs, originalLanguage string, certifications data.Certifications, batchSize int, fn func(*data.Movie) error) error {
+	for i := 1; i <= m.count; i++ {
+		err := fn(&data.Movie{ID: int64(i), Title: "Moana", Year: 2016, Runtime: 107, Genres: []string{"animation"}, Version: 1})
+		if err != nil {
+			return err
+		}
+	}
+	return errors.New("connection reset by the database")
+}
+
+func TestExportFilters(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+	token := ts.newUser(t, "writer@example.com", "movies:write")
+
+	for _, movie := range []map[string]any{
+		{"title": "Moana", "year": 2016, "runtime": 107, "genres": []string{"animation"},
+			"external_ids": map[string]string{"imdb": "tt3521164"}, "original_language": "en", "certifications": map[string]string{"US": "PG"}},
+		{"title": "Amélie", "year": 2001, "runtime": 122, "genres": []string{"comedy"},
+			"original_language": "fr", "certifications": map[string]string{"US": "R"}},
+		{"title": "Frozen", "year": 2013, "runtime": 102, "genres": []string{"animation"},
+			"original_language": "en", "certifications": map[string]string{"US": "PG"}},
+	} {
+		ts.mustDo(t, http.StatusCreated, http.MethodPost, "/v1/movies", token, movie)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{name: "no filters", query: "", want: []string{"Moana", "Amélie", "Frozen"}},
+		{name: "genres", query: "genres=animation", want: []string{"Moana", "Frozen"}},
+		{name: "external id", query: "imdb_id=tt3521164", want: []string{"Moana"}},
+		{name: "original language", query: "original_language=fr", want: []string{"Amélie"}},
+		{name: "certification", query: "certification=US:PG", want: []string{"Moana", "Frozen"}},
+		{name: "combined", query: "certification=US:PG&title=frozen", want: []string{"Frozen"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := ts.mustDo(t, http.StatusOK, http.MethodGet, "/v1/movies/export?format=json&"+tt.query, token, nil)
+			titles := []string{}
+			for _, movie := range field[[]any](t, resp.body, "movies") {
+				titles = append(titles, movie.(map[string]any)["title"].(string))
+			}
+			if !reflect.DeepEqual(titles, tt.want) {
+				t.Errorf("got %v, want %v", titles, tt.want)
+			}
+		})
+	}
+
+	rejected := []struct {
+		query string
+		field string
+	}{
+		{query: "format=xml", field: "format"},
+		{query: "original_language=French", field: "original_language"},
+		{query: "certification=PG", field: "certification"},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.query, func(t *testing.T) {
+			resp := ts.mustDo(t, http.StatusUnprocessableEntity, http.MethodGet, "/v1/movies/export?"+tt.query, token, nil)
+			if _, ok := field[map[string]any](t, resp.body, "error")[tt.field]; !ok {
+				t.Errorf("got errors %v, want one for %s", resp.body["error"], tt.field)
+			}
+		})
+	}
+}
+
+func TestExportAborted(t *testing.T) {
+	app, _ := newTestApplication(t)
+	var logs lockedBuffer
+	app.logger = jsonlog.New(&logs, jsonlog.LevelInfo)
+	app.models.Movies = failingExport{MovieRepository: app.models.Movies, count: exportFlushEvery + 1}
+	ts := newTestServer(t, app)
+	token := ts.newUser(t, "reader@example.com", "movies:read")
+
+	res, err := ts.Client().Do(ts.newRequest(t, http.MethodGet, "/v1/movies/export", token, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err == nil {
+		t.Fatalf("got a complete export of %d bytes, want the connection dropped", len(body))
+	}
+
+	var entry struct {
+		Message    string            `json:"message"`
+		Properties map[string]string `json:"properties"`
+	}
+	requestID := res.Header.Get("X-Request-ID")
+	for _, line := range strings.Split(logs.String(), "\n") {
+		if strings.Contains(line, `"message":"request"`) && strings.Contains(line, requestID) {
+			err := json.Unmarshal([]byte(line), &entry)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if entry.Message != "request" {
+		t.Fatalf("got no access log entry for the aborted export in %s", logs.String())
+	}
+	if entry.Properties["aborted"] != "true" || entry.Properties["status"] != "200" {
+		t.Errorf("got access log properties %v, want an aborted 200", entry.Properties)
+	}
+	if n, _ := strconv.Atoi(entry.Properties["bytes"]); n < len(body) || n == 0 {
+		t.Errorf("got %s bytes logged, want at least the %d the client received", entry.Properties["bytes"], len(body))
+	}
+}
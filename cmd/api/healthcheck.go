@@ -1,9 +1,171 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"sync"
+	"time"
 )
 
+const (
+	checkPass = "pass"
+	checkFail = "fail"
+)
+
+// checkResult is the outcome of a single readiness check. Details holds the
+// measurements the check was decided on. Messages are served to anyone who can reach
+// the endpoint, so errors from a dependency are logged and reported as unavailable.
+type checkResult struct {
+	Status  string         `json:"status"`
+	Message string         `json:"message,omitempty"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// cachedCheck remembers the result of a check that is too slow or intrusive to run on
+// every probe.
+type cachedCheck struct {
+	mu      sync.Mutex
+	checked time.Time
+	err     error
+}
+
+// get returns the cached result of fn, running it again once ttl has passed. Concurrent
+// callers wait for a single run.
+func (c *cachedCheck) get(ttl time.Duration, fn func() error) (checked time.Time, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.checked.IsZero() || time.Since(c.checked) >= ttl {
+		c.err = fn()
+		c.checked = time.Now()
+	}
+	return c.checked, c.err
+}
+
+// reset forgets the cached result, so that the next call runs the check again.
+func (c *cachedCheck) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checked = time.Time{}
+}
+
+// readinessChecks runs every dependency check and reports whether all of them passed.
+// There is no database to check when the models keep their records in memory.
+func (app *application) readinessChecks(ctx context.Context) (map[string]checkResult, bool) {
+	checks := map[string]checkResult{
+		"smtp":       app.checkSMTP(),
+		"background": app.checkBackground(),
+		"shutdown":   app.checkShutdown(),
+	}
+	if app.db != nil {
+		checks["database"] = app.checkDatabase(ctx)
+		checks["database_pool"] = app.checkDatabasePool()
+	}
+	ready := true
+	for _, check := range checks {
+		if check.Status != checkPass {
+			ready = false
+		}
+	}
+	return checks, ready
+}
+
+func (app *application) checkDatabase(ctx context.Context) checkResult {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	err := app.db.PingContext(ctx)
+	latency := time.Since(start)
+	details := map[string]any{"latency_ms": latency.Milliseconds()}
+	switch {
+	case err != nil:
+		app.logger.PrintErrorContext(ctx, err, map[string]string{"check": "database"})
+		return checkResult{Status: checkFail, Message: "unavailable", Details: details}
+	case latency > app.config.health.dbLatency:
+		return checkResult{Status: checkFail, Message: fmt.Sprintf("ping took longer than %s", app.config.health.dbLatency), Details: details}
+	default:
+		return checkResult{Status: checkPass, Details: details}
+	}
+}
+
+func (app *application) checkDatabasePool() checkResult {
+	stats := app.db.Stats()
+	details := map[string]any{
+		"in_use":         stats.InUse,
+		"idle":           stats.Idle,
+		"max_open":       stats.MaxOpenConnections,
+		"wait_count":     stats.WaitCount,
+		"wait_duration":  stats.WaitDuration.String(),
+		"max_saturation": app.config.health.poolSaturation,
+	}
+	if stats.MaxOpenConnections <= 0 {
+		return checkResult{Status: checkPass, Details: details}
+	}
+	saturation := float64(stats.InUse) / float64(stats.MaxOpenConnections)
+	details["saturation"] = saturation
+	if saturation > app.config.health.poolSaturation {
+		return checkResult{Status: checkFail, Message: "connection pool is saturated", Details: details}
+	}
+	return checkResult{Status: checkPass, Details: details}
+}
+
+// checkSMTP reports whether the mail server accepted a connection, reusing the last
+// result until the cache TTL has passed.
+func (app *application) checkSMTP() checkResult {
+	checked, err := app.smtpCheck.get(app.config.health.smtpCacheTTL, func() error {
+		err := app.mailer.Ping()
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"check": "smtp"})
+		}
+		return err
+	})
+	details := map[string]any{"checked_at": checked.UTC().Format(time.RFC3339)}
+	if err != nil {
+		return checkResult{Status: checkFail, Message: "unavailable", Details: details}
+	}
+	return checkResult{Status: checkPass, Details: details}
+}
+
+func (app *application) checkBackground() checkResult {
+	running := app.backgroundTasks.Load()
+	details := map[string]any{"running": running, "max_running": app.config.health.backgroundBacklog}
+	if running > int64(app.config.health.backgroundBacklog) {
+		return checkResult{Status: checkFail, Message: "too many background tasks are running", Details: details}
+	}
+	return checkResult{Status: checkPass, Details: details}
+}
+
+func (app *application) checkShutdown() checkResult {
+	if app.shuttingDown.Load() {
+		return checkResult{Status: checkFail, Message: "server is shutting down"}
+	}
+	return checkResult{Status: checkPass}
+}
+
+// livenessHandler only reports that the process is able to serve requests. It never
+// checks dependencies, so an outage elsewhere doesn't get the server restarted.
+func (app *application) livenessHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"status": "alive"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readinessHandler reports whether the server should receive traffic, answering 503
+// with the result of every check if any of them failed.
+func (app *application) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	checks, ready := app.readinessChecks(r.Context())
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+	err := app.writeJSON(w, code, envelope{"status": status, "checks": checks}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
 // Declare a handler which writes a plain-text response with information about the
 // application status, operating environment and version.
 func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Request) {
@@ -18,12 +180,18 @@ func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Reques
 	//
 	//w.Write([]byte(js))
 
+	checks, ready := app.readinessChecks(r.Context())
+	status, code := "available", http.StatusOK
+	if !ready {
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
 	env := envelope{
-		"status": "available",
+		"status": status,
 		"system_info": map[string]string{
 			"enviroment": app.config.env,
 			"version":    version,
 		},
+		"checks": checks,
 	}
 	//js, err := json.Marshal(data)
 	//if err != nil {
@@ -34,7 +202,7 @@ func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Reques
 	//js = append(js, '\n')
 	//w.Header().Set("Content-Type", "application/json")
 	//w.Write([]byte(js))
-	err := app.writeJSON(w, http.StatusOK, env, nil)
+	err := app.writeJSON(w, code, env, nil)
 	if err != nil {
 		//app.logger.Print(err)
 		//http.Error(w, "The server encountered a problem and could not process your request", http.StatusInternalServerError)
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"greenlight.darkhanomirbay/internal/jsonlog"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestReadinessHidesErrors(t *testing.T) {
+	app, mailer := newTestApplication(t)
+	var logs lockedBuffer
+	app.logger = jsonlog.New(&logs, jsonlog.LevelInfo)
+	mailer.pingErr = errors.New("dial tcp 10.0.0.5:25: connect: connection refused")
+	ts := newTestServer(t, app)
+
+	for _, path := range []string{"/readyz", "/v1/healthcheck"} {
+		resp := ts.mustDo(t, http.StatusServiceUnavailable, http.MethodGet, path, "", nil)
+		if got := field[string](t, resp.body, "checks", "smtp", "message"); got != "unavailable" {
+			t.Errorf("%s: got smtp message %q, want unavailable", path, got)
+		}
+		if body := fmt.Sprint(resp.body); strings.Contains(body, "10.0.0.5") {
+			t.Errorf("%s: the response reveals the mail server: %s", path, body)
+		}
+	}
+	if !strings.Contains(logs.String(), "10.0.0.5") {
+		t.Errorf("the smtp error wasn't logged: %s", logs.String())
+	}
+}
@@ -1,30 +1,71 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/julienschmidt/httprouter"
+	"greenlight.darkhanomirbay/internal/data"
 	"greenlight.darkhanomirbay/internal/validator"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type envelope map[string]any
 
 func (app *application) readIDParam(r *http.Request) (int64, error) {
+	return app.readIntParam(r, "id")
+}
+func (app *application) readIntParam(r *http.Request, name string) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
 
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
-	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+	i, err := strconv.ParseInt(params.ByName(name), 10, 64)
+	if err != nil || i < 1 {
+		return 0, fmt.Errorf("invalid %s parameter", name)
+	}
+	return i, nil
+}
+
+// readMovie loads the movie named by the id URL parameter. If that fails the error
+// response has already been sent and ok is false.
+func (app *application) readMovie(w http.ResponseWriter, r *http.Request) (movie *data.Movie, ok bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	movie, err = app.models.Movies.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return movie, true
+}
+
+// hideEditorFields strips the fields only editors need, such as versions and who made a
+// change, from values about to be sent to an anonymous user.
+func hideEditorFields[T interface{ HideEditorFields() }](user *data.User, values ...T) {
+	if !user.IsAnonymous() {
+		return
+	}
+	for _, value := range values {
+		value.HideEditorFields()
 	}
-	return id, nil
 }
 func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
+	setRuntimeFormat(data, responseRuntimeFormat(w))
 	js, err := json.MarshalIndent(data, "", "\t")
 	if err != nil {
 		return err
@@ -86,6 +127,66 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
 	return nil
 
 }
+func (app *application) readMediaType(r *http.Request) string {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+// readLocales returns the locales in the Accept-Language header in order of preference,
+// lower cased and without their quality values. Each regional locale is followed by its
+// language, so "fr-CA, en" yields fr-ca, fr and en. Wildcards are ignored.
+func (app *application) readLocales(r *http.Request) []string {
+	type weightedLocale struct {
+		locale  string
+		quality float64
+	}
+	var weighted []weightedLocale
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		locale, params, _ := strings.Cut(part, ";")
+		locale = strings.ToLower(strings.TrimSpace(locale))
+		if locale == "" || locale == "*" {
+			continue
+		}
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			q, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			quality = q
+		}
+		if quality <= 0 {
+			continue
+		}
+		weighted = append(weighted, weightedLocale{locale, quality})
+	}
+	sort.SliceStable(weighted, func(i, j int) bool {
+		return weighted[i].quality > weighted[j].quality
+	})
+
+	var locales []string
+	seen := make(map[string]bool)
+	for _, w := range weighted {
+		for locale := w.locale; locale != ""; {
+			if !seen[locale] {
+				seen[locale] = true
+				locales = append(locales, locale)
+			}
+			i := strings.LastIndex(locale, "-")
+			if i < 0 {
+				break
+			}
+			locale = locale[:i]
+		}
+		if len(locales) >= 10 {
+			return locales[:10]
+		}
+	}
+	return locales
+}
 func (app *application) readString(qs url.Values, key string, defaultValue string) string {
 	s := qs.Get(key)
 
@@ -114,12 +215,26 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	}
 	return i
 }
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+	return b
+}
 func (app *application) background(fn func()) {
 	app.wg.Add(1)
+	app.backgroundTasks.Add(1)
 
 	// Launch a background goroutine.
 	go func() {
 		defer app.wg.Done()
+		defer app.backgroundTasks.Add(-1)
 
 		// Recover any panic.
 
@@ -132,3 +247,24 @@ func (app *application) background(fn func()) {
 		fn()
 	}()
 }
+
+// backgroundJob runs fn every interval in a background goroutine until the server starts
+// shutting down. Errors are logged and don't stop the job. A run still going when ctx is
+// cancelled is expected to give up.
+func (app *application) backgroundJob(ctx context.Context, name string, interval time.Duration, fn func(context.Context) error) {
+	app.background(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-app.shutdown:
+				return
+			case <-ticker.C:
+				err := fn(ctx)
+				if err != nil {
+					app.logger.PrintError(err, map[string]string{"job": name})
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"greenlight.darkhanomirbay/internal/data"
+	"greenlight.darkhanomirbay/internal/validator"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	importBatchSize = 500
+	importMaxBytes  = 100 << 20
+	importMaxErrors = 1000
+)
+
+// movieRowReader reads one movie per call from an import stream. Problems with a single
+// row are returned as field errors so the import can carry on, while err is only set
+// for errors that end the stream (including io.EOF).
+type movieRowReader interface {
+	Next() (movie *data.Movie, fieldErrors map[string]string, err error)
+}
+
+type importRowError struct {
+	Row    int               `json:"row"`
+	Errors map[string]string `json:"errors"`
+}
+
+type importReport struct {
+	Mode            string           `json:"mode"`
+	Rows            int              `json:"rows"`
+	Imported        int              `json:"imported"`
+	Failed          int              `json:"failed"`
+	Errors          []importRowError `json:"errors"`
+	ErrorsTruncated bool             `json:"errors_truncated,omitempty"`
+}
+
+func (r *importReport) addError(row int, fieldErrors map[string]string) {
+	r.Failed++
+	if len(r.Errors) >= importMaxErrors {
+		r.ErrorsTruncated = true
+		return
+	}
+	r.Errors = append(r.Errors, importRowError{Row: row, Errors: fieldErrors})
+}
+
+func (app *application) importMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	mode := app.readString(r.URL.Query(), "mode", "all-or-nothing")
+	v.Check(validator.PermittedValue(mode, "all-or-nothing", "best-effort"), "mode", "must be either all-or-nothing or best-effort")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	bestEffort := mode == "best-effort"
+
+	body := http.MaxBytesReader(w, r.Body, importMaxBytes)
+	var rows movieRowReader
+	switch app.readMediaType(r) {
+	case "text/csv":
+		var err error
+		rows, err = newCSVMovieReader(body)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	case "application/x-ndjson":
+		rows = newNDJSONMovieReader(body)
+	default:
+		app.unsupportedMediaTypeResponse(w, r, "text/csv", "application/x-ndjson")
+		return
+	}
+
+	imp, err := app.models.Movies.BeginImport(r.Context(), bestEffort, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// Rolling back after a successful commit is a no-op.
+	defer imp.Rollback()
+
+	report := importReport{Mode: mode, Errors: []importRowError{}}
+	batch := make([]*data.Movie, 0, importBatchSize)
+	batchRows := make([]int, 0, importBatchSize)
+
+	flush := func() error {
+		defer func() {
+			batch = batch[:0]
+			batchRows = batchRows[:0]
+		}()
+		// Once a row has failed an all-or-nothing import is going to be rolled back, so
+		// there is no point in copying any more rows.
+		if len(batch) == 0 || (!bestEffort && report.Failed > 0) {
+			return nil
+		}
+		err := imp.CopyBatch(r.Context(), batch)
+		var rejected *data.ImportRowsRejectedError
+		switch {
+		case err == nil:
+			report.Imported += len(batch)
+		case errors.As(err, &rejected):
+			for n, row := range batchRows {
+				if reason, ok := rejected.Rows[n]; ok {
+					report.addError(row, map[string]string{"row": reason})
+				} else {
+					report.Imported++
+				}
+			}
+		case errors.Is(err, data.ErrImportBatchRejected):
+			for _, row := range batchRows {
+				report.addError(row, map[string]string{"batch": err.Error()})
+			}
+		default:
+			return err
+		}
+		return nil
+	}
+
+	for {
+		movie, fieldErrors, err := rows.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			var maxBytesError *http.MaxBytesError
+			switch {
+			case errors.As(err, &maxBytesError):
+				app.badRequestResponse(w, r, fmt.Errorf("body mustnt be larger than %d bytes", maxBytesError.Limit))
+			default:
+				app.badRequestResponse(w, r, err)
+			}
+			return
+		}
+		report.Rows++
+
+		if fieldErrors == nil {
+			v := validator.New()
+			if data.ValidateMovie(v, movie); !v.Valid() {
+				fieldErrors = v.Errors
+			}
+		}
+		if fieldErrors != nil {
+			report.addError(report.Rows, fieldErrors)
+			continue
+		}
+
+		batch = append(batch, movie)
+		batchRows = append(batchRows, report.Rows)
+		if len(batch) == importBatchSize {
+			if err := flush(); err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !bestEffort && report.Failed > 0 {
+		report.Imported = 0
+		err = app.writeJSON(w, http.StatusUnprocessableEntity, envelope{"import": report}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = imp.Commit()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"import": report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// csvColumns are the columns a CSV import may have. The first four are required.
+var csvColumns = []string{"title", "year", "runtime", "genres", "external_ids", "tagline", "synopsis", "original_language", "release_dates", "certifications"}
+
+// csvMovieReader reads movies from CSV with a header row naming the columns in any order.
+// Runtime may be written in any form data.ParseRuntime accepts. Genres are separated by
+// commas inside a quoted field, and so are the key:value pairs of external_ids,
+// release_dates and certifications, such as "imdb:tt3521164,tmdb:277834".
+type csvMovieReader struct {
+	r       *csv.Reader
+	columns map[string]int
+}
+
+func newCSVMovieReader(r io.Reader) (*csvMovieReader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("body must not be empty")
+		}
+		return nil, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !validator.PermittedValue(name, csvColumns...) {
+			return nil, fmt.Errorf("csv header contains unknown column %q", name)
+		}
+		if _, exists := columns[name]; exists {
+			return nil, fmt.Errorf("csv header contains duplicate column %q", name)
+		}
+		columns[name] = i
+	}
+	for _, name := range csvColumns[:4] {
+		if _, exists := columns[name]; !exists {
+			return nil, fmt.Errorf("csv header must contain a %q column", name)
+		}
+	}
+	return &csvMovieReader{r: cr, columns: columns}, nil
+}
+func (c *csvMovieReader) Next() (*data.Movie, map[string]string, error) {
+	record, err := c.r.Read()
+	if err != nil {
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) {
+			return nil, map[string]string{"row": parseError.Err.Error()}, nil
+		}
+		return nil, nil, err
+	}
+	if len(record) != len(c.columns) {
+		return nil, map[string]string{"row": fmt.Sprintf("must contain %d fields", len(c.columns))}, nil
+	}
+	// field returns the value of an optional column, or "" if there is no such column.
+	field := func(name string) string {
+		i, ok := c.columns[name]
+		if !ok {
+			return ""
+		}
+		return record[i]
+	}
+
+	fieldErrors := make(map[string]string)
+	movie := &data.Movie{
+		Title:            field("title"),
+		Tagline:          field("tagline"),
+		Synopsis:         field("synopsis"),
+		OriginalLanguage: strings.TrimSpace(field("original_language")),
+	}
+
+	year, err := strconv.ParseInt(strings.TrimSpace(field("year")), 10, 32)
+	if err != nil {
+		fieldErrors["year"] = "must be an integer value"
+	}
+	movie.Year = int32(year)
+
+	runtime, err := data.ParseRuntime(field("runtime"))
+	if err != nil {
+		fieldErrors["runtime"] = "must be a runtime such as 102, 1h 42m or PT1H42M"
+	}
+	movie.Runtime = runtime
+
+	movie.Genres = []string{}
+	for _, genre := range strings.Split(field("genres"), ",") {
+		if genre = strings.TrimSpace(genre); genre != "" {
+			movie.Genres = append(movie.Genres, genre)
+		}
+	}
+
+	var ok bool
+	if movie.ExternalIDs, ok = parseCSVPairs(field("external_ids")); !ok {
+		fieldErrors["external_ids"] = "must be a list of source:id pairs"
+	}
+	if movie.ReleaseDates, ok = parseCSVPairs(field("release_dates")); !ok {
+		fieldErrors["release_dates"] = "must be a list of country:date pairs"
+	}
+	if movie.Certifications, ok = parseCSVPairs(field("certifications")); !ok {
+		fieldErrors["certifications"] = "must be a list of country:rating pairs"
+	}
+
+	if len(fieldErrors) > 0 {
+		return nil, fieldErrors, nil
+	}
+	return movie, nil, nil
+}
+
+// parseCSVPairs parses comma separated key:value pairs. It reports false if a pair has
+// no colon, an empty key or value, or a key that was seen before.
+func parseCSVPairs(s string) (map[string]string, bool) {
+	pairs := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		key, value, found := strings.Cut(pair, ":")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if _, seen := pairs[key]; !found || key == "" || value == "" || seen {
+			return nil, false
+		}
+		pairs[key] = value
+	}
+	return pairs, true
+}
+
+// ndjsonMovieReader reads movies from newline-delimited JSON, one object with the same
+// fields as the create movie request body per line. Blank lines are skipped.
+type ndjsonMovieReader struct {
+	s *bufio.Scanner
+}
+
+func newNDJSONMovieReader(r io.Reader) *ndjsonMovieReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), 1_048_576)
+	return &ndjsonMovieReader{s: s}
+}
+func (n *ndjsonMovieReader) Next() (*data.Movie, map[string]string, error) {
+	for n.s.Scan() {
+		line := bytes.TrimSpace(n.s.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var input movieInput
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.DisallowUnknownFields()
+		err := dec.Decode(&input)
+		if err != nil {
+			return nil, map[string]string{"row": err.Error()}, nil
+		}
+		if dec.More() {
+			return nil, map[string]string{"row": "must only contain a single JSON value"}, nil
+		}
+		return input.movie(), nil, nil
+	}
+	if err := n.s.Err(); err != nil {
+		return nil, nil, err
+	}
+	return nil, nil, io.EOF
+}
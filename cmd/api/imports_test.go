@@ -0,0 +1,194 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// importMovies posts body to the import endpoint as contentType.
+func (ts *testServer) importMovies(t *testing.T, token, mode, contentType, body string) response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/v1/movies/import?mode="+mode, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return ts.send(t, req)
+}
+
+func TestImportMetadata(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+	token := ts.newUser(t, "writer@example.com", "movies:write")
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		imdb        string
+	}{
+		{
+			name:        "ndjson",
+			contentType: "application/x-ndjson",
+			body: `{"title":"Moana","year":2016,"runtime":107,"genres":["animation"],"external_ids":{"imdb":"tt3521164"},` +
+				`"tagline":"The ocean is calling.","synopsis":"A voyage.","original_language":"en",` +
+				`"release_dates":{"US":"2016-11-23"},"certifications":{"US":"PG"}}` + "\n",
+			imdb: "tt3521164",
+		},
+		{
+			name:        "csv",
+			contentType: "text/csv",
+			body: "title,year,runtime,genres,external_ids,tagline,synopsis,original_language,release_dates,certifications\n" +
+				`Frozen,2013,102,animation,imdb:tt2294629,Only the act of true love will thaw a frozen heart.,A voyage.,en,US:2013-11-27,US:PG` + "\n",
+			imdb: "tt2294629",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := ts.importMovies(t, token, "all-or-nothing", tt.contentType, tt.body)
+			if resp.status != http.StatusOK {
+				t.Fatalf("got status %d, want 200; body %v", resp.status, resp.body)
+			}
+
+			resp = ts.mustDo(t, http.StatusOK, http.MethodGet, "/v1/movies?imdb_id="+tt.imdb, token, nil)
+			movies := field[[]any](t, resp.body, "movies")
+			if len(movies) != 1 {
+				t.Fatalf("got %d movies with imdb id %s, want 1", len(movies), tt.imdb)
+			}
+			movie := movies[0].(map[string]any)
+			for _, name := range []string{"tagline", "synopsis", "original_language", "release_dates", "certifications"} {
+				if _, ok := movie[name]; !ok {
+					t.Errorf("the imported movie has no %s: %v", name, movie)
+				}
+			}
+
+			resp = ts.mustDo(t, http.StatusOK, http.MethodGet, moviePath(int64(movie["id"].(float64)))+"/revisions", token, nil)
+			if revisions := field[[]any](t, resp.body, "revisions"); len(revisions) != 1 {
+				t.Errorf("got %d revisions of the imported movie, want 1", len(revisions))
+			}
+		})
+	}
+}
+
+func TestImportRejectedRows(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+	token := ts.newUser(t, "writer@example.com", "movies:write")
+
+	ts.mustDo(t, http.StatusCreated, http.MethodPost, "/v1/movies", token, map[string]any{
+		"title":        "Moana",
+		"year":         2016,
+		"runtime":      107,
+		"genres":       []string{"animation"},
+		"external_ids": map[string]string{"imdb": "tt3521164"},
+	})
+
+	// The second row clashes with the existing movie and the fourth with the third.
+	body := strings.Join([]string{
+		`{"title":"Zootopia","year":2016,"runtime":108,"genres":["animation"]}`,
+		`{"title":"Moana (Sing-Along)","year":2016,"runtime":107,"genres":["animation"],"external_ids":{"imdb":"tt3521164"}}`,
+		`{"title":"Frozen","year":2013,"runtime":102,"genres":["animation"],"external_ids":{"imdb":"tt2294629"}}`,
+		`{"title":"Frozen (Sing-Along)","year":2013,"runtime":102,"genres":["animation"],"external_ids":{"imdb":"tt2294629"}}`,
+	}, "\n")
+	resp := ts.importMovies(t, token, "best-effort", "application/x-ndjson", body)
+	if resp.status != http.StatusOK {
+		t.Fatalf("got status %d, want 200; body %v", resp.status, resp.body)
+	}
+	if got := field[float64](t, resp.body, "import", "imported"); got != 2 {
+		t.Errorf("got %v rows imported, want 2", got)
+	}
+	var rows []float64
+	for _, e := range field[[]any](t, resp.body, "import", "errors") {
+		e := e.(map[string]any)
+		rows = append(rows, e["row"].(float64))
+		if reason := e["errors"].(map[string]any)["row"]; reason != "a movie with one of these external ids already exists" {
+			t.Errorf("got reason %v for row %v", reason, e["row"])
+		}
+	}
+	if want := []float64{2, 4}; !reflect.DeepEqual(rows, want) {
+		t.Errorf("got errors for rows %v, want %v", rows, want)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+	token := ts.newUser(t, "writer@example.com", "movies:write")
+
+	const (
+		valid   = `{"title":"Zootopia","year":2016,"runtime":108,"genres":["animation"]}`
+		invalid = `{"title":"","year":2016,"runtime":108,"genres":["animation"]}`
+	)
+	tests := []struct {
+		name        string
+		mode        string
+		contentType string
+		body        string
+		status      int
+		error       []string // the path of the error message in the response
+		message     string
+		imported    float64
+		failed      float64
+	}{
+		{
+			name: "unknown mode", mode: "some", contentType: "application/x-ndjson", body: valid,
+			status: http.StatusUnprocessableEntity, error: []string{"error", "mode"},
+			message: "must be either all-or-nothing or best-effort",
+		},
+		{
+			name: "unsupported media type", mode: "best-effort", contentType: "application/json", body: valid,
+			status: http.StatusUnsupportedMediaType, error: []string{"error"},
+			message: "the request body must be one of the following media types: text/csv, application/x-ndjson",
+		},
+		{
+			name: "empty csv", mode: "best-effort", contentType: "text/csv", body: "",
+			status: http.StatusBadRequest, error: []string{"error"}, message: "body must not be empty",
+		},
+		{
+			name: "csv missing column", mode: "best-effort", contentType: "text/csv", body: "title,year,runtime\nZootopia,2016,108\n",
+			status: http.StatusBadRequest, error: []string{"error"}, message: `csv header must contain a "genres" column`,
+		},
+		{
+			name: "csv unknown column", mode: "best-effort", contentType: "text/csv", body: "title,year,runtime,genres,rating\n",
+			status: http.StatusBadRequest, error: []string{"error"}, message: `csv header contains unknown column "rating"`,
+		},
+		{
+			name: "all-or-nothing", mode: "all-or-nothing", contentType: "application/x-ndjson", body: valid + "\n" + invalid,
+			status: http.StatusUnprocessableEntity, imported: 0, failed: 1,
+		},
+		{
+			name: "best-effort", mode: "best-effort", contentType: "application/x-ndjson", body: valid + "\n" + invalid,
+			status: http.StatusOK, imported: 1, failed: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := ts.mustDo(t, http.StatusOK, http.MethodGet, "/v1/movies", token, nil)
+			resp := ts.importMovies(t, token, tt.mode, tt.contentType, tt.body)
+			if resp.status != tt.status {
+				t.Fatalf("got status %d, want %d; body %v", resp.status, tt.status, resp.body)
+			}
+			if tt.error != nil {
+				if got := field[string](t, resp.body, tt.error...); got != tt.message {
+					t.Errorf("got error %q, want %q", got, tt.message)
+				}
+				return
+			}
+			if got := field[float64](t, resp.body, "import", "imported"); got != tt.imported {
+				t.Errorf("got %v rows imported, want %v", got, tt.imported)
+			}
+			if got := field[float64](t, resp.body, "import", "failed"); got != tt.failed {
+				t.Errorf("got %v rows failed, want %v", got, tt.failed)
+			}
+
+			after := ts.mustDo(t, http.StatusOK, http.MethodGet, "/v1/movies", token, nil)
+			added := len(field[[]any](t, after.body, "movies")) - len(field[[]any](t, before.body, "movies"))
+			if float64(added) != tt.imported {
+				t.Errorf("got %v movies added, want %v", added, tt.imported)
+			}
+		})
+	}
+}
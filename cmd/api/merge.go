@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"greenlight.darkhanomirbay/internal/data"
+	"greenlight.darkhanomirbay/internal/validator"
+	"net/http"
+	"strings"
+)
+
+// mergeMovieHandler merges the movie given by source_id into the movie in the URL,
+// which survives the merge.
+func (app *application) mergeMovieHandler(w http.ResponseWriter, r *http.Request) {
+	target, ok := app.readMovie(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		SourceID int64             `json:"source_id"`
+		Strategy string            `json:"strategy"`
+		Fields   map[string]string `json:"fields"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Strategy == "" {
+		input.Strategy = data.MergeKeepTarget
+	}
+
+	v := validator.New()
+	v.Check(input.SourceID > 0, "source_id", "must be provided")
+	v.Check(input.SourceID != target.ID, "source_id", "must not be the movie being merged into")
+	v.Check(validator.PermittedValue(input.Strategy, data.MergeKeepTarget, data.MergeKeepSource), "strategy", "must be either target or source")
+	for field, choice := range input.Fields {
+		v.Check(validator.PermittedValue(field, data.MergeFields...), "fields", "must only contain "+strings.Join(data.MergeFields, ", "))
+		v.Check(validator.PermittedValue(choice, data.MergeKeepTarget, data.MergeKeepSource), "fields."+field, "must be either target or source")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	source, err := app.models.Movies.Get(r.Context(), input.SourceID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("source_id", "movie not found")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data.MergeMovies(target, source, input.Strategy, input.Fields)
+	if data.ValidateMovie(v, target); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Movies.Merge(r.Context(), target, source, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateExternalID):
+			v.AddError("external_ids", "a movie with one of these external ids already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// The target only takes over the source's poster and backdrop if it had none of
+	// its own.
+	if source.PosterKey != "" && source.PosterKey != target.PosterKey {
+		app.background(func() {
+			app.deleteArtwork(source.PosterKey, source.Poster)
+		})
+	}
+	if source.BackdropKey != "" && source.BackdropKey != target.BackdropKey {
+		app.background(func() {
+			app.deleteArtwork(source.BackdropKey, source.Backdrop)
+		})
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": target}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
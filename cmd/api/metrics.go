@@ -0,0 +1,166 @@
+package main
+
+import (
+	"database/sql"
+	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// metrics holds the Prometheus collectors of the application. They are registered with
+// a registry of their own and served on the admin port.
+type metrics struct {
+	registry         *prometheus.Registry
+	requests         *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	requestsInFlight *prometheus.GaugeVec
+	rateLimited      *prometheus.CounterVec
+	emails           *prometheus.CounterVec
+}
+
+// newMetrics creates the collectors. The connection pool statistics are left out when
+// db is nil, as it is with in-memory storage.
+func newMetrics(db *sql.DB, backgroundTasks *atomic.Int64) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "greenlight_http_requests_total",
+			Help: "Number of HTTP requests served, by method, route and status.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "greenlight_http_request_duration_seconds",
+			Help:    "Time taken to serve HTTP requests, by method, route and status.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		requestsInFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "greenlight_http_requests_in_flight",
+			Help: "Number of HTTP requests being served, by method and route.",
+		}, []string{"method", "route"}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "greenlight_rate_limit_rejections_total",
+			Help: "Number of requests rejected by the rate limiter, by the limit that applied.",
+		}, []string{"limit"}),
+		emails: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "greenlight_emails_total",
+			Help: "Number of emails the mailer tried to send, by template and outcome.",
+		}, []string{"template", "outcome"}),
+	}
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.requestsInFlight,
+		m.rateLimited,
+		m.emails,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "greenlight_background_tasks",
+			Help: "Number of background goroutines running.",
+		}, func() float64 {
+			return float64(backgroundTasks.Load())
+		}),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if db != nil {
+		m.registry.MustRegister(collectors.NewDBStatsCollector(db, "greenlight"))
+	}
+	return m
+}
+
+// handler serves the metrics in the Prometheus exposition format.
+func (m *metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// emailSent records the outcome of sending an email with the given template.
+func (m *metrics) emailSent(template string, err error) {
+	outcome := "sent"
+	if err != nil {
+		outcome = "failed"
+	}
+	m.emails.WithLabelValues(template, outcome).Inc()
+}
+
+// patternRouter is an httprouter.Router that remembers the pattern each handler was
+// registered with, so that requests can be labelled by route rather than by URL.
+type patternRouter struct {
+	*httprouter.Router
+	patterns *httprouter.Router
+}
+
+func newPatternRouter() *patternRouter {
+	return &patternRouter{Router: httprouter.New(), patterns: httprouter.New()}
+}
+
+func (pr *patternRouter) HandlerFunc(method, path string, handler http.HandlerFunc) {
+	pr.Router.HandlerFunc(method, path, handler)
+	pr.patterns.Handle(method, path, func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		w.(*patternCapture).pattern = path
+	})
+}
+
+// staticID registers next at path, which has an :id parameter, and lets fixed segments
+// such as /v1/movies/export share the position of the parameter, which httprouter
+// refuses to register side by side. Requests whose id matches a key in static are
+// passed to that handler instead of next, and are labelled with the fixed path.
+func (pr *patternRouter) staticID(method, path string, next http.HandlerFunc, static map[string]http.HandlerFunc) {
+	pr.Router.HandlerFunc(method, path, func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+		if handler, ok := static[params.ByName("id")]; ok {
+			handler(w, r)
+			return
+		}
+		next(w, r)
+	})
+	pr.patterns.Handle(method, path, func(w http.ResponseWriter, _ *http.Request, params httprouter.Params) {
+		pattern := path
+		if id := params.ByName("id"); static[id] != nil {
+			pattern = strings.Replace(path, ":id", id, 1)
+		}
+		w.(*patternCapture).pattern = pattern
+	})
+}
+
+// patternCapture receives the pattern of a route from the handles of pr.patterns.
+type patternCapture struct {
+	http.ResponseWriter
+	pattern string
+}
+
+// Pattern returns the pattern of the route the request will be routed to, or
+// "unmatched" for requests that no route accepts.
+func (pr *patternRouter) Pattern(r *http.Request) string {
+	handle, params, _ := pr.patterns.Lookup(r.Method, r.URL.Path)
+	if handle == nil {
+		return "unmatched"
+	}
+	var capture patternCapture
+	handle(&capture, r, params)
+	return capture.pattern
+}
+
+// instrument records the count, duration and concurrency of the requests served by
+// next, labelled by the route the router matches them to.
+func (app *application) instrument(router *patternRouter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := router.Pattern(r)
+
+		inFlight := app.metrics.requestsInFlight.WithLabelValues(r.Method, route)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := time.Now()
+		sw := newStatusResponseWriter(w)
+		defer func() {
+			status := strconv.Itoa(sw.statusCode)
+			app.metrics.requests.WithLabelValues(r.Method, route, status).Inc()
+			app.metrics.requestDuration.WithLabelValues(r.Method, route, status).Observe(time.Since(start).Seconds())
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	// Opening a pool does not connect, so the pool statistics can be collected without
+	// a server.
+	db, err := sql.Open("postgres", "postgres://localhost/greenlight")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		name   string
+		db     *sql.DB
+		dbPool bool
+	}{
+		{name: "postgres", db: db, dbPool: true},
+		{name: "memory", db: nil, dbPool: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var backgroundTasks atomic.Int64
+			m := newMetrics(tt.db, &backgroundTasks)
+			ts := httptest.NewServer(m.handler())
+			defer ts.Close()
+
+			res, err := ts.Client().Get(ts.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			body, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != http.StatusOK {
+				t.Fatalf("got status %d, want 200; body %s", res.StatusCode, body)
+			}
+			if !strings.Contains(string(body), "greenlight_background_tasks") {
+				t.Errorf("the metrics do not include greenlight_background_tasks:\n%s", body)
+			}
+			if got := strings.Contains(string(body), "go_sql_max_open_connections"); got != tt.dbPool {
+				t.Errorf("got pool statistics %t, want %t", got, tt.dbPool)
+			}
+		})
+	}
+}
+
+func TestRouteLabels(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+	token := ts.newUser(t, "reader@example.com", "movies:read")
+
+	ts.mustDo(t, http.StatusOK, http.MethodGet, "/v1/movies/export?format=json", token, nil)
+	ts.mustDo(t, http.StatusNotFound, http.MethodGet, "/v1/movies/42", token, nil)
+
+	rec := httptest.NewRecorder()
+	app.metrics.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`greenlight_http_requests_total{method="GET",route="/v1/movies/export",status="200"} 1`,
+		`greenlight_http_requests_total{method="GET",route="/v1/movies/:id",status="404"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("the metrics do not include %s:\n%s", want, body)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"golang.org/x/time/rate"
@@ -8,15 +11,91 @@ import (
 	"greenlight.darkhanomirbay/internal/validator"
 	"net"
 	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
+// requestIDRX matches the request IDs accepted from clients and proxies.
+var requestIDRX = regexp.MustCompile(`^[A-Za-z0-9._:\-]{1,128}$`)
+
+// requestID gives every request an ID, taken from the X-Request-ID header if the client
+// or a proxy sent a usable one and generated otherwise. The ID is echoed in the
+// response, so that a client report can be matched with the server logs.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDRX.MatchString(id) {
+			b := make([]byte, 16)
+			_, err := rand.Read(b)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			id = hex.EncodeToString(b)
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, app.contextSetRequestID(r, id))
+	})
+}
+
+// accessLogEntry collects what the access log needs to know about a request from
+// further down the middleware chain.
+type accessLogEntry struct {
+	user *data.User
+}
+
+// logRequests writes an access log line for every request once it has been served.
+func (app *application) logRequests(router *patternRouter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		entry := &accessLogEntry{}
+		r = r.WithContext(context.WithValue(r.Context(), accessLogContextKey, entry))
+
+		sw := newStatusResponseWriter(w)
+		// The entry is written from a deferred call so that responses aborted with
+		// http.ErrAbortHandler are logged too, with the bytes sent before the abort.
+		defer func() {
+			aborted := recover()
+			properties := map[string]string{
+				"request_id": app.contextGetRequestID(r),
+				"method":     r.Method,
+				"route":      router.Pattern(r),
+				"status":     strconv.Itoa(sw.statusCode),
+				"bytes":      strconv.FormatInt(sw.bytesWritten, 10),
+				"duration":   time.Since(start).String(),
+				"remote_ip":  r.RemoteAddr,
+			}
+			if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+				properties["remote_ip"] = ip
+			}
+			if entry.user != nil && !entry.user.IsAnonymous() {
+				properties["user_id"] = strconv.FormatInt(entry.user.ID, 10)
+			}
+			if aborted != nil {
+				properties["aborted"] = "true"
+			}
+			app.logger.PrintInfoContext(r.Context(), "request", properties)
+			if aborted != nil {
+				panic(aborted)
+			}
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
+
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
+				// http.ErrAbortHandler is used to drop a connection after the response
+				// has started, so let the server handle it rather than writing an error.
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
 				w.Header().Set("Connection", "close")
 				app.serverErrorResponse(w, r, fmt.Errorf("%s", err))
 			}
@@ -48,21 +127,29 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 	}()
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if app.config.limiter.enabled {
+		cfg := app.currentConfig()
+		if cfg.limiter.enabled {
 			ip, _, err := net.SplitHostPort(r.RemoteAddr)
 			if err != nil {
 				app.serverErrorResponse(w, r, err)
 				return
 			}
+			// While the catalogue is open to the public, callers without a token share
+			// a stricter limit of their own.
+			key, limit, rps, burst := ip, "client", cfg.limiter.rps, cfg.limiter.burst
+			if cfg.anonymous.enabled && r.Header.Get("Authorization") == "" {
+				key, limit, rps, burst = "anonymous "+ip, "anonymous", cfg.anonymous.rps, cfg.anonymous.burst
+			}
 			mu.Lock()
 
-			if _, found := clients[ip]; !found {
-				clients[ip] = &client{limitter: rate.NewLimiter(rate.Limit(app.config.limiter.rps), app.config.limiter.burst)}
-
+			// Clients already seen start afresh when a reload changes their limits.
+			if c, found := clients[key]; !found || c.limitter.Limit() != rate.Limit(rps) || c.limitter.Burst() != burst {
+				clients[key] = &client{limitter: rate.NewLimiter(rate.Limit(rps), burst)}
 			}
-			clients[ip].lastSeen = time.Now()
-			if !clients[ip].limitter.Allow() {
+			clients[key].lastSeen = time.Now()
+			if !clients[key].limitter.Allow() {
 				mu.Unlock()
+				app.metrics.rateLimited.WithLabelValues(limit).Inc()
 				app.rateLimitExceededResponse(w, r)
 				return
 			}
@@ -71,9 +158,143 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// enableCORS lets browsers call the API from the trusted origins. Preflight requests
+// from those origins are answered here and go no further.
+func (app *application) enableCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+
+		origin := r.Header.Get("Origin")
+		if origin != "" {
+			for _, trusted := range app.currentConfig().cors.trustedOrigins {
+				if origin != trusted {
+					continue
+				}
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+					w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
+					w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+					w.WriteHeader(http.StatusOK)
+					return
+				}
+				break
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// statusResponseWriter records the status code and size of the response, for middleware
+// that reports on it after the handler returns.
+type statusResponseWriter struct {
+	http.ResponseWriter
+	statusCode   int
+	bytesWritten int64
+	wroteHeader  bool
+}
+
+func (sw *statusResponseWriter) WriteHeader(statusCode int) {
+	if !sw.wroteHeader {
+		sw.statusCode = statusCode
+		sw.wroteHeader = true
+	}
+	sw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (sw *statusResponseWriter) Write(b []byte) (int, error) {
+	sw.wroteHeader = true
+	n, err := sw.ResponseWriter.Write(b)
+	sw.bytesWritten += int64(n)
+	return n, err
+}
+
+func (sw *statusResponseWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+func newStatusResponseWriter(w http.ResponseWriter) *statusResponseWriter {
+	return &statusResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+}
+
+// runtimeFormatWriter carries the runtime format a client asked for down to writeJSON.
+type runtimeFormatWriter struct {
+	http.ResponseWriter
+	format data.RuntimeFormat
+}
+
+func (w *runtimeFormatWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// responseRuntimeFormat returns the runtime format chosen for the response written to
+// w, looking through any wrappers that provide an Unwrap method.
+func responseRuntimeFormat(w http.ResponseWriter) data.RuntimeFormat {
+	for {
+		switch rw := w.(type) {
+		case *runtimeFormatWriter:
+			return rw.format
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return data.RuntimeFormatMins
+		}
+	}
+}
+
+// runtimeFormatter is implemented by values that hold runtimes, such as movies and
+// revisions, which are written in the format set on them.
+type runtimeFormatter interface {
+	SetRuntimeFormat(format data.RuntimeFormat)
+}
+
+// setRuntimeFormat sets the runtime format on the values of env that hold runtimes,
+// whether they are in the envelope directly or in a slice.
+func setRuntimeFormat(env envelope, format data.RuntimeFormat) {
+	for _, value := range env {
+		if f, ok := value.(runtimeFormatter); ok {
+			f.SetRuntimeFormat(format)
+			continue
+		}
+		rv := reflect.ValueOf(value)
+		if rv.Kind() != reflect.Slice {
+			continue
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if f, ok := rv.Index(i).Interface().(runtimeFormatter); ok {
+				f.SetRuntimeFormat(format)
+			}
+		}
+	}
+}
+
+// runtimeFormat lets clients choose how movie runtimes are written in responses with
+// the runtime_format query parameter or, failing that, the Runtime-Format header.
+func (app *application) runtimeFormat(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Runtime-Format")
+
+		format := data.RuntimeFormat(r.URL.Query().Get("runtime_format"))
+		if format == "" {
+			format = data.RuntimeFormat(r.Header.Get("Runtime-Format"))
+		}
+		if format == "" || format == data.RuntimeFormatMins {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !validator.PermittedValue(format, data.RuntimeFormats...) {
+			v := validator.New()
+			v.AddError("runtime_format", "must be one of mins, minutes, human, iso8601 or duration")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		next.ServeHTTP(&runtimeFormatWriter{ResponseWriter: w, format: format}, r)
+	})
+}
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Vary", "Authorization")
+		w.Header().Add("Vary", "Authorization")
 		authorizationHeader := r.Header.Get("Authorization")
 		if authorizationHeader == "" {
 			r = app.contextSetUser(r, data.AnonymousUser)
@@ -91,7 +312,7 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			app.invalidAuthenticationTokenResponse(w, r)
 			return
 		}
-		user, err := app.models.Users.GetForToken(data.ScopeAuthentication, token)
+		user, err := app.models.Users.GetForToken(r.Context(), data.ScopeAuthentication, token)
 		if err != nil {
 			switch {
 			case errors.Is(err, data.ErrRecordNotFound):
@@ -137,7 +358,7 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 		// Retrieve the user from the request context.
 		user := app.contextGetUser(r)
 		// Get the slice of permissions for the user.
-		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		permissions, err := app.models.Permissions.GetAllForUser(r.Context(), user.ID)
 		if err != nil {
 			app.serverErrorResponse(w, r, err)
 			return
@@ -153,5 +374,15 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 		next.ServeHTTP(w, r)
 	}
 	// Wrap this with the requireActivatedUser() middleware before returning it.
-	return app.requireActivatedUser(fn)
+	activated := app.requireActivatedUser(fn)
+
+	// In anonymous mode, callers without a token may use the anonymous permissions.
+	return func(w http.ResponseWriter, r *http.Request) {
+		anonymous := app.currentConfig().anonymous
+		if anonymous.enabled && app.contextGetUser(r).IsAnonymous() && anonymous.permissions.Include(code) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		activated.ServeHTTP(w, r)
+	}
 }
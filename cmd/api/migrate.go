@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"greenlight.darkhanomirbay/internal/jsonlog"
+	"greenlight.darkhanomirbay/internal/migrate"
+	"greenlight.darkhanomirbay/migrations"
+	"io"
+	"strconv"
+	"text/tabwriter"
+)
+
+const migrateUsage = "usage: api [flags] migrate up | down [N] | status | goto VERSION"
+
+// migrateCommand runs the migrate subcommand against the database in -db-dsn. Status
+// is written to out; everything else is logged.
+func migrateCommand(cfg config, logger *jsonlog.Logger, out io.Writer, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	var ran int
+	switch {
+	case args[0] == "up" && len(args) == 1:
+		ran, err = migrator.Up(ctx)
+	case args[0] == "down" && len(args) <= 2:
+		steps := 1
+		if len(args) == 2 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of migrations %q", args[1])
+			}
+		}
+		ran, err = migrator.Down(ctx, steps)
+	case args[0] == "goto" && len(args) == 2:
+		var version int
+		version, err = strconv.Atoi(args[1])
+		if err != nil || version < 0 {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		ran, err = migrator.Goto(ctx, version)
+	case args[0] == "status" && len(args) == 1:
+		return migrationStatus(ctx, migrator, out)
+	default:
+		return errors.New(migrateUsage)
+	}
+	if err != nil {
+		return err
+	}
+
+	version, _, err := migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+	logger.PrintInfo("database migrated", map[string]string{
+		"migrations_run": strconv.Itoa(ran),
+		"version":        strconv.Itoa(version),
+	})
+	return nil
+}
+
+// migrationStatus writes a table of the known migrations and whether each is applied.
+func migrationStatus(ctx context.Context, migrator *migrate.Migrator, out io.Writer) error {
+	statuses, version, dirty, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS")
+	for _, status := range statuses {
+		state := "pending"
+		switch {
+		case status.Version == version && dirty:
+			state = "dirty"
+		case status.Applied:
+			state = "applied"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", status.Version, status.Name, state)
+	}
+	err = tw.Flush()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "\ndatabase version %d of %d\n", version, migrator.Latest())
+	return err
+}
+
+// autoMigrate applies pending migrations at startup. Instances started together take
+// turns, and all but the first find nothing to do.
+func autoMigrate(db *sql.DB, logger *jsonlog.Logger) error {
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+	ran, err := migrator.Up(context.Background())
+	if err != nil {
+		return err
+	}
+	logger.PrintInfo("database migrated", map[string]string{
+		"migrations_run": strconv.Itoa(ran),
+		"version":        strconv.Itoa(migrator.Latest()),
+	})
+	return nil
+}
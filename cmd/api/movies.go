@@ -1,20 +1,51 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"greenlight.darkhanomirbay/internal/data"
+	"greenlight.darkhanomirbay/internal/patch"
 	"greenlight.darkhanomirbay/internal/validator"
 	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
 )
 
-func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Title   string       `json:"title"`
-		Year    int32        `json:"year"`
-		Runtime data.Runtime `json:"runtime"`
-		Genres  []string     `json:"genres"`
+// movieInput is the body of a create movie request. Movie imports read their rows into
+// it as well.
+type movieInput struct {
+	Title            string              `json:"title"`
+	Year             int32               `json:"year"`
+	Runtime          data.Runtime        `json:"runtime"`
+	Genres           []string            `json:"genres"`
+	ExternalIDs      data.ExternalIDs    `json:"external_ids"`
+	Tagline          string              `json:"tagline"`
+	Synopsis         string              `json:"synopsis"`
+	OriginalLanguage string              `json:"original_language"`
+	ReleaseDates     data.ReleaseDates   `json:"release_dates"`
+	Certifications   data.Certifications `json:"certifications"`
+}
+
+func (input movieInput) movie() *data.Movie {
+	return &data.Movie{
+		Title:            input.Title,
+		Year:             input.Year,
+		Runtime:          input.Runtime,
+		Genres:           input.Genres,
+		ExternalIDs:      input.ExternalIDs,
+		Tagline:          input.Tagline,
+		Synopsis:         input.Synopsis,
+		OriginalLanguage: input.OriginalLanguage,
+		ReleaseDates:     input.ReleaseDates,
+		Certifications:   input.Certifications,
 	}
+}
+
+func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Request) {
+	var input movieInput
 	// json.Unmarshal!!!
 	//body, err := io.ReadAll(r.Body)
 	//if err != nil {
@@ -30,20 +61,41 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	if err != nil {
 		//app.errorResponse(w, r, http.StatusBadRequest, err.Error())
 		app.badRequestResponse(w, r, err)
+		return
 	}
 	v := validator.New()
-	movie := &data.Movie{
-		Title:   input.Title,
-		Year:    input.Year,
-		Runtime: input.Runtime,
-		Genres:  input.Genres}
+	movie := input.movie()
 	if data.ValidateMovie(v, movie); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	err = app.models.Movies.Insert(movie)
+	force := app.readBool(r.URL.Query(), "force", false, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Unless the client insists, refuse to create what looks like a film that is
+	// already in the catalogue.
+	if !force {
+		duplicates, err := app.models.Movies.FindDuplicates(r.Context(), movie)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if len(duplicates) > 0 {
+			app.duplicateMovieResponse(w, r, duplicates)
+			return
+		}
+	}
+	err = app.models.Movies.Insert(r.Context(), movie, app.contextGetUser(r).ID)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrDuplicateExternalID):
+			v.AddError("external_ids", "a movie with one of these external ids already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 	headers := make(http.Header)
@@ -89,11 +141,11 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 	//	Genres:    []string{"drama", "romance", "war"},
 	//	Version:   1,
 	//}
-	movie, err := app.models.Movies.Get(id)
+	movie, err := app.models.Movies.Get(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
+			app.movieRedirectResponse(w, r, id)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
@@ -101,20 +153,55 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	err = app.models.Translations.Localize(r.Context(), []*data.Movie{movie}, app.readLocales(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	hideEditorFields(app.contextGetUser(r), movie)
+	headers := make(http.Header)
+	w.Header().Add("Vary", "Accept-Language")
+	if movie.Locale != "" {
+		headers.Set("Content-Language", movie.Locale)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 
 	}
 	//fmt.Fprintf(w, "movie id is %d", id)
 }
+
+// movieRedirectResponse sends a 301 to the movie that the missing movie id was merged
+// into, or a 404 if it wasn't merged.
+func (app *application) movieRedirectResponse(w http.ResponseWriter, r *http.Request, id int64) {
+	newID, err := app.models.Movies.GetRedirect(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	location := fmt.Sprintf("/v1/movies/%d", newID)
+	headers := make(http.Header)
+	headers.Set("Location", location)
+
+	err = app.writeJSON(w, http.StatusMovedPermanently, envelope{"message": "the movie has been merged into another one", "location": location}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
 func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIDParam(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
 		return
 	}
-	movie, err := app.models.Movies.Get(id)
+	movie, err := app.models.Movies.Get(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -124,54 +211,202 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		}
 		return
 	}
-	var input struct {
-		Title   *string       `json:"title"`
-		Year    *int32        `json:"year"`
-		Runtime *data.Runtime `json:"runtime"`
-		Genres  []string      `json:"genres"`
-	}
-	err = app.readJSON(w, r, &input)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
-	}
-	if input.Title != nil {
-		movie.Title = *input.Title
-	}
-	if input.Year != nil {
-		movie.Year = *input.Year
-	}
-	if input.Runtime != nil {
-		movie.Runtime = *input.Runtime
-	}
-	if input.Genres != nil {
-		movie.Genres = input.Genres
-	}
 	v := validator.New()
+	switch mediaType := app.readMediaType(r); mediaType {
+	case "", "application/json":
+		var input struct {
+			Title            *string             `json:"title"`
+			Year             *int32              `json:"year"`
+			Runtime          *data.Runtime       `json:"runtime"`
+			Genres           []string            `json:"genres"`
+			ExternalIDs      data.ExternalIDs    `json:"external_ids"`
+			Tagline          *string             `json:"tagline"`
+			Synopsis         *string             `json:"synopsis"`
+			OriginalLanguage *string             `json:"original_language"`
+			ReleaseDates     data.ReleaseDates   `json:"release_dates"`
+			Certifications   data.Certifications `json:"certifications"`
+		}
+		err = app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		if input.Title != nil {
+			movie.Title = *input.Title
+		}
+		if input.Year != nil {
+			movie.Year = *input.Year
+		}
+		if input.Runtime != nil {
+			movie.Runtime = *input.Runtime
+		}
+		if input.Genres != nil {
+			movie.Genres = input.Genres
+		}
+		if input.ExternalIDs != nil {
+			movie.ExternalIDs = input.ExternalIDs
+		}
+		if input.Tagline != nil {
+			movie.Tagline = *input.Tagline
+		}
+		if input.Synopsis != nil {
+			movie.Synopsis = *input.Synopsis
+		}
+		if input.OriginalLanguage != nil {
+			movie.OriginalLanguage = *input.OriginalLanguage
+		}
+		if input.ReleaseDates != nil {
+			movie.ReleaseDates = input.ReleaseDates
+		}
+		if input.Certifications != nil {
+			movie.Certifications = input.Certifications
+		}
+	case patch.MergePatchMediaType, patch.JSONPatchMediaType:
+		err = app.patchMovie(w, r, mediaType, movie, v)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	default:
+		w.Header().Set("Accept-Patch", patch.MergePatchMediaType+", "+patch.JSONPatchMediaType)
+		app.unsupportedMediaTypeResponse(w, r, "application/json", patch.MergePatchMediaType, patch.JSONPatchMediaType)
+		return
+	}
 	if data.ValidateMovie(v, movie); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
+		return
 	}
-	err = app.models.Movies.Update(movie)
+	err = app.models.Movies.Update(r.Context(), movie, app.contextGetUser(r).ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
 			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateExternalID):
+			v.AddError("external_ids", "a movie with one of these external ids already exists")
+			app.failedValidationResponse(w, r, v.Errors)
 		default:
 			app.serverErrorResponse(w, r, err)
-
 		}
+		return
 	}
 	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// patchMovie applies a JSON Merge Patch or JSON Patch document from the request body to
+// the JSON representation of movie and copies the result back into it. The id, version,
+// poster, backdrop and collection fields are read-only and may only be used in test
+// operations. Malformed patches are returned as errors, while a failed test operation
+// or a patch that leaves an invalid movie is reported through v and leaves movie as it
+// was.
+func (app *application) patchMovie(w http.ResponseWriter, r *http.Request, mediaType string, movie *data.Movie, v *validator.Validator) error {
+	js, err := json.Marshal(movie)
+	if err != nil {
+		return err
+	}
+	var doc any
+	err = json.Unmarshal(js, &doc)
+	if err != nil {
+		return err
+	}
+
+	switch mediaType {
+	case patch.MergePatchMediaType:
+		var mergePatch any
+		err = app.readJSON(w, r, &mergePatch)
+		if err != nil {
+			return err
+		}
+		doc = patch.Merge(doc, mergePatch)
+	default:
+		var ops []patch.Operation
+		err = app.readJSON(w, r, &ops)
+		if err != nil {
+			return err
+		}
+		doc, err = patch.Apply(doc, ops)
+		if err != nil {
+			if errors.Is(err, patch.ErrTestFailed) {
+				v.AddError("patch", err.Error())
+				return nil
+			}
+			return err
+		}
+	}
+	// Localized responses carry the original title and the locale alongside the
+	// translation. They aren't stored, so a document sent back as it was read may
+	// include them.
+	if fields, ok := doc.(map[string]any); ok {
+		delete(fields, "original_title")
+		delete(fields, "locale")
+	}
+
+	js, err = json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	var patched struct {
+		ID               int64                 `json:"id"`
+		Title            string                `json:"title"`
+		Year             int32                 `json:"year"`
+		Runtime          data.Runtime          `json:"runtime"`
+		Genres           []string              `json:"genres"`
+		Poster           data.Artwork          `json:"poster"`
+		Backdrop         data.Artwork          `json:"backdrop"`
+		ExternalIDs      data.ExternalIDs      `json:"external_ids"`
+		Tagline          string                `json:"tagline"`
+		Synopsis         string                `json:"synopsis"`
+		OriginalLanguage string                `json:"original_language"`
+		ReleaseDates     data.ReleaseDates     `json:"release_dates"`
+		Certifications   data.Certifications   `json:"certifications"`
+		Collection       *data.MovieCollection `json:"collection"`
+		Version          int32                 `json:"version"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&patched)
+	if err != nil {
+		var typeError *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &typeError) && typeError.Field != "":
+			v.AddError(typeError.Field, "has the wrong type")
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			v.AddError(strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`), "is not a movie field")
+		default:
+			v.AddError("patch", fmt.Sprintf("patched movie is invalid: %s", err))
+		}
+		return nil
+	}
+	v.Check(patched.ID == movie.ID, "id", "cannot be modified")
+	v.Check(patched.Version == movie.Version, "version", "cannot be modified")
+	v.Check(reflect.DeepEqual(patched.Poster, movie.Poster), "poster", "cannot be modified")
+	v.Check(reflect.DeepEqual(patched.Backdrop, movie.Backdrop), "backdrop", "cannot be modified")
+	v.Check(reflect.DeepEqual(patched.Collection, movie.Collection), "collection", "cannot be modified")
+	if !v.Valid() {
+		return nil
+	}
+
+	movie.Title = patched.Title
+	movie.Year = patched.Year
+	movie.Runtime = patched.Runtime
+	movie.Genres = patched.Genres
+	movie.ExternalIDs = patched.ExternalIDs
+	movie.Tagline = patched.Tagline
+	movie.Synopsis = patched.Synopsis
+	movie.OriginalLanguage = patched.OriginalLanguage
+	movie.ReleaseDates = patched.ReleaseDates
+	movie.Certifications = patched.Certifications
+	return nil
+}
 func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIDParam(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
 		return
 	}
-	err = app.models.Movies.Delete(id)
+	err = app.models.Movies.Delete(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -183,24 +418,62 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie successfully deleted"}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie successfully moved to the trash"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 
 }
+
+// movieSearch holds the filters shared by the movie list and export endpoints.
+type movieSearch struct {
+	Title            string
+	Genres           []string
+	ExternalIDs      data.ExternalIDs
+	OriginalLanguage string
+	Certifications   data.Certifications
+}
+
+// readMovieSearch reads and validates the movie search filters in the query string.
+func (app *application) readMovieSearch(qs url.Values, v *validator.Validator) movieSearch {
+	var search movieSearch
+	search.Title = app.readString(qs, "title", "")
+	search.Genres = app.readCsv(qs, "genres", []string{})
+	search.ExternalIDs = data.ExternalIDs{}
+	for source := range data.ExternalIDSources {
+		if id := app.readString(qs, source+"_id", ""); id != "" {
+			search.ExternalIDs[source] = id
+		}
+	}
+	search.OriginalLanguage = app.readString(qs, "original_language", "")
+	// Certifications are filtered on as country:rating pairs, e.g. certification=US:PG-13,GB:12A.
+	search.Certifications = data.Certifications{}
+	for _, pair := range app.readCsv(qs, "certification", []string{}) {
+		country, rating, ok := strings.Cut(pair, ":")
+		if !ok || !validator.Matches(country, data.CountryRX) || rating == "" {
+			v.AddError("certification", "must be a list of country:rating pairs")
+			continue
+		}
+		search.Certifications[country] = rating
+	}
+
+	if search.OriginalLanguage != "" {
+		v.Check(validator.Matches(search.OriginalLanguage, data.LanguageRX), "original_language", "must be a lower case ISO 639 language code")
+	}
+	data.ValidateExternalIDs(v, search.ExternalIDs)
+	return search
+}
+
 func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title   string
-		Genres  []string
+		movieSearch
 		Filters data.Filters
 	}
 
 	v := validator.New()
 	qs := r.URL.Query()
 
-	input.Title = app.readString(qs, "title", "")
-	input.Genres = app.readCsv(qs, "genres", []string{})
+	input.movieSearch = app.readMovieSearch(qs, v)
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 	input.Filters.Sort = app.readString(qs, "sort", "id")
@@ -210,14 +483,21 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
+	movies, metadata, err := app.models.Movies.GetAll(r.Context(), input.Title, input.Genres, input.ExternalIDs, input.OriginalLanguage, input.Certifications, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.models.Translations.Localize(r.Context(), movies, app.readLocales(r))
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	hideEditorFields(app.contextGetUser(r), movies...)
+	w.Header().Add("Vary", "Accept-Language")
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"movies": movies, "metadata": metadata}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
-	fmt.Fprintf(w, "%+v\n", input)
 }
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"greenlight.darkhanomirbay/internal/data"
+	"net/http"
+	"testing"
+)
+
+func TestMovieCRUD(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+	token := ts.newUser(t, "writer@example.com", "movies:write")
+
+	resp := ts.mustDo(t, http.StatusCreated, http.MethodPost, "/v1/movies", token, map[string]any{
+		"title":   "Moana",
+		"year":    2016,
+		"runtime": "107 mins",
+		"genres":  []string{"animation", "adventure"},
+	})
+	id := int64(field[float64](t, resp.body, "movie", "id"))
+	if got, want := resp.header.Get("Location"), moviePath(id); got != want {
+		t.Errorf("got Location %q, want %q", got, want)
+	}
+
+	resp = ts.mustDo(t, http.StatusOK, http.MethodGet, moviePath(id), token, nil)
+	if got := field[string](t, resp.body, "movie", "title"); got != "Moana" {
+		t.Errorf("got title %q, want Moana", got)
+	}
+	if got := field[string](t, resp.body, "movie", "runtime"); got != "107 mins" {
+		t.Errorf("got runtime %q, want 107 mins", got)
+	}
+	if got := field[float64](t, resp.body, "movie", "version"); got != 1 {
+		t.Errorf("got version %v, want 1", got)
+	}
+
+	resp = ts.mustDo(t, http.StatusOK, http.MethodPatch, moviePath(id), token, map[string]any{"year": 2017})
+	if got := field[float64](t, resp.body, "movie", "year"); got != 2017 {
+		t.Errorf("got year %v, want 2017", got)
+	}
+	if got := field[float64](t, resp.body, "movie", "version"); got != 2 {
+		t.Errorf("got version %v, want 2", got)
+	}
+
+	resp = ts.mustDo(t, http.StatusOK, http.MethodGet, "/v1/movies?title=moana", token, nil)
+	if got := len(field[[]any](t, resp.body, "movies")); got != 1 {
+		t.Errorf("got %d movies, want 1", got)
+	}
+	if got := field[float64](t, resp.body, "metadata", "total_records"); got != 1 {
+		t.Errorf("got total_records %v, want 1", got)
+	}
+
+	ts.mustDo(t, http.StatusOK, http.MethodDelete, moviePath(id), token, nil)
+	ts.mustDo(t, http.StatusNotFound, http.MethodGet, moviePath(id), token, nil)
+	ts.mustDo(t, http.StatusNotFound, http.MethodPatch, moviePath(id), token, map[string]any{"year": 2018})
+	ts.mustDo(t, http.StatusNotFound, http.MethodDelete, moviePath(id), token, nil)
+	ts.mustDo(t, http.StatusNotFound, http.MethodGet, "/v1/movies/abc", token, nil)
+}
+
+func TestMovieValidation(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+	token := ts.newUser(t, "writer@example.com", "movies:write")
+
+	valid := func(changes map[string]any) map[string]any {
+		movie := map[string]any{"title": "Moana", "year": 2016, "runtime": 107, "genres": []string{"animation"}}
+		for key, value := range changes {
+			movie[key] = value
+		}
+		return movie
+	}
+	tests := []struct {
+		name    string
+		body    map[string]any
+		field   string
+		message string
+	}{
+		{name: "missing title", body: valid(map[string]any{"title": ""}), field: "title", message: "must be provided"},
+		{name: "early year", body: valid(map[string]any{"year": 1800}), field: "year", message: "must be greater than 1888"},
+		{name: "future year", body: valid(map[string]any{"year": 3000}), field: "year", message: "must not be in the future"},
+		{name: "missing runtime", body: valid(map[string]any{"runtime": 0}), field: "runtime", message: "must be provided"},
+		{name: "no genres", body: valid(map[string]any{"genres": []string{}}), field: "genres", message: "must contain at least 1 genre"},
+		{name: "duplicate genres", body: valid(map[string]any{"genres": []string{"drama", "drama"}}), field: "genres", message: "must not contain duplicate values"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := ts.mustDo(t, http.StatusUnprocessableEntity, http.MethodPost, "/v1/movies", token, tt.body)
+			if got := field[string](t, resp.body, "error", tt.field); got != tt.message {
+				t.Errorf("got %s error %q, want %q", tt.field, got, tt.message)
+			}
+		})
+	}
+
+	badRequests := []struct {
+		name string
+		body map[string]any
+	}{
+		{name: "unknown field", body: valid(map[string]any{"rating": 5})},
+		{name: "wrong type", body: valid(map[string]any{"year": "2016"})},
+		{name: "invalid runtime", body: valid(map[string]any{"runtime": "long"})},
+	}
+	for _, tt := range badRequests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts.mustDo(t, http.StatusBadRequest, http.MethodPost, "/v1/movies", token, tt.body)
+		})
+	}
+
+	t.Run("duplicate external id", func(t *testing.T) {
+		ts.mustDo(t, http.StatusCreated, http.MethodPost, "/v1/movies", token, valid(map[string]any{"external_ids": map[string]string{"imdb": "tt3521164"}}))
+		resp := ts.mustDo(t, http.StatusUnprocessableEntity, http.MethodPost, "/v1/movies?force=true", token, valid(map[string]any{"external_ids": map[string]string{"imdb": "tt3521164"}}))
+		if got := field[string](t, resp.body, "error", "external_ids"); got == "" {
+			t.Error("got no external_ids error")
+		}
+	})
+
+	t.Run("likely duplicate", func(t *testing.T) {
+		resp := ts.mustDo(t, http.StatusConflict, http.MethodPost, "/v1/movies", token, valid(nil))
+		if got := len(field[[]any](t, resp.body, "duplicates")); got != 1 {
+			t.Errorf("got %d duplicates, want 1", got)
+		}
+	})
+}
+
+// racingMovies loses every update to another editor, who changes the movie after the
+// handler has read it.
+type racingMovies struct {
+	data.MovieRepository
+}
+
+func (m racingMovies) Update(ctx context.Context, movie *data.Movie, editorID int64) error {
+	other, err := m.MovieRepository.Get(ctx, movie.ID)
+	if err != nil {
+		return err
+	}
+	other.Tagline = "Changed by someone else"
+	err = m.MovieRepository.Update(ctx, other, editorID)
+	if err != nil {
+		return err
+	}
+	return m.MovieRepository.Update(ctx, movie, editorID)
+}
+
+func TestMovieEditConflict(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+	token := ts.newUser(t, "writer@example.com", "movies:write")
+
+	resp := ts.mustDo(t, http.StatusCreated, http.MethodPost, "/v1/movies", token, map[string]any{
+		"title": "Moana", "year": 2016, "runtime": 107, "genres": []string{"animation"},
+	})
+	id := int64(field[float64](t, resp.body, "movie", "id"))
+
+	app.models.Movies = racingMovies{app.models.Movies}
+	resp = ts.mustDo(t, http.StatusConflict, http.MethodPatch, moviePath(id), token, map[string]any{"year": 2017})
+	if got, want := field[string](t, resp.body, "error"), "unable to update the record due to an edit conflict, please try again"; got != want {
+		t.Errorf("got error %q, want %q", got, want)
+	}
+
+	movie, err := app.models.Movies.Get(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movie.Year != 2016 || movie.Version != 2 {
+		t.Errorf("got year %d at version %d, want the other editor's change at 2016 and version 2", movie.Year, movie.Version)
+	}
+}
+
+// clashingMerges fails every merge as if the merged external ids belonged to a third
+// movie.
+type clashingMerges struct {
+	data.MovieRepository
+}
+
+func (clashingMerges) Merge(ctx context.Context, target, source *data.Movie, editorID int64) error {
+	return data.ErrDuplicateExternalID
+}
+
+// racingMerges loses every merge to another editor, who changes the target after the
+// handler has read it.
+type racingMerges struct {
+	data.MovieRepository
+}
+
+func (m racingMerges) Merge(ctx context.Context, target, source *data.Movie, editorID int64) error {
+	other, err := m.MovieRepository.Get(ctx, target.ID)
+	if err != nil {
+		return err
+	}
+	other.Tagline = "Changed by someone else"
+	err = m.MovieRepository.Update(ctx, other, editorID)
+	if err != nil {
+		return err
+	}
+	return m.MovieRepository.Merge(ctx, target, source, editorID)
+}
+
+func TestMergeConflicts(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+	token := ts.newUser(t, "writer@example.com", "movies:write")
+
+	// The first movie is merged into, the second merged from and the third is in the trash.
+	var ids []int64
+	for i, imdb := range []string{"tt3521164", "tt3521165", "tt3521166"} {
+		resp := ts.mustDo(t, http.StatusCreated, http.MethodPost, "/v1/movies", token, map[string]any{
+			"title": fmt.Sprintf("Moana %d", i+1), "year": 2016, "runtime": 107, "genres": []string{"animation"},
+			"external_ids": map[string]string{"imdb": imdb},
+		})
+		ids = append(ids, int64(field[float64](t, resp.body, "movie", "id")))
+	}
+	ts.mustDo(t, http.StatusOK, http.MethodDelete, moviePath(ids[2]), token, nil)
+	movies := app.models.Movies
+
+	tests := []struct {
+		name    string
+		movies  data.MovieRepository
+		target  int64
+		input   map[string]any
+		status  int
+		error   []string // the path of the error message in the response
+		message string
+	}{
+		{
+			name: "no source", target: ids[0], input: map[string]any{},
+			status: http.StatusUnprocessableEntity, error: []string{"error", "source_id"}, message: "must be provided",
+		},
+		{
+			name: "itself", target: ids[0], input: map[string]any{"source_id": ids[0]},
+			status: http.StatusUnprocessableEntity, error: []string{"error", "source_id"}, message: "must not be the movie being merged into",
+		},
+		{
+			name: "unknown source", target: ids[0], input: map[string]any{"source_id": 999},
+			status: http.StatusUnprocessableEntity, error: []string{"error", "source_id"}, message: "movie not found",
+		},
+		{
+			name: "trashed source", target: ids[0], input: map[string]any{"source_id": ids[2]},
+			status: http.StatusUnprocessableEntity, error: []string{"error", "source_id"}, message: "movie not found",
+		},
+		{
+			name: "unknown strategy", target: ids[0], input: map[string]any{"source_id": ids[1], "strategy": "newest"},
+			status: http.StatusUnprocessableEntity, error: []string{"error", "strategy"}, message: "must be either target or source",
+		},
+		{
+			name: "unknown target", target: 999, input: map[string]any{"source_id": ids[1]},
+			status: http.StatusNotFound, error: []string{"error"}, message: "the requested resource could not be found",
+		},
+		{
+			name: "trashed target", target: ids[2], input: map[string]any{"source_id": ids[1]},
+			status: http.StatusNotFound, error: []string{"error"}, message: "the requested resource could not be found",
+		},
+		{
+			name: "edit conflict", movies: racingMerges{movies}, target: ids[0], input: map[string]any{"source_id": ids[1]},
+			status: http.StatusConflict, error: []string{"error"}, message: "unable to update the record due to an edit conflict, please try again",
+		},
+		{
+			name: "duplicate external ids", movies: clashingMerges{movies}, target: ids[0], input: map[string]any{"source_id": ids[1]},
+			status: http.StatusUnprocessableEntity, error: []string{"error", "external_ids"}, message: "a movie with one of these external ids already exists",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.movies != nil {
+				app.models.Movies = tt.movies
+			}
+			defer func() { app.models.Movies = movies }()
+
+			resp := ts.mustDo(t, tt.status, http.MethodPost, moviePath(tt.target)+"/merge", token, tt.input)
+			if got := field[string](t, resp.body, tt.error...); got != tt.message {
+				t.Errorf("got error %q, want %q", got, tt.message)
+			}
+
+			// Neither movie was changed by the failed merge.
+			resp = ts.mustDo(t, http.StatusOK, http.MethodGet, moviePath(ids[1]), token, nil)
+			if got := field[string](t, resp.body, "movie", "external_ids", "imdb"); got != "tt3521165" {
+				t.Errorf("got source imdb id %q, want it kept", got)
+			}
+		})
+	}
+}
+
+func TestPatchMovie(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+	token := ts.newUser(t, "writer@example.com", "movies:write")
+
+	resp := ts.mustDo(t, http.StatusCreated, http.MethodPost, "/v1/movies", token, map[string]any{
+		"title": "Moana", "year": 2016, "runtime": 107, "genres": []string{"animation"},
+	})
+	id := int64(field[float64](t, resp.body, "movie", "id"))
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        any
+		status      int
+		errorField  string
+	}{
+		{
+			name:        "merge patch",
+			contentType: "application/merge-patch+json",
+			body:        map[string]any{"tagline": "The ocean is calling."},
+			status:      http.StatusOK,
+		},
+		{
+			name:        "merge patch with the localized presentation fields",
+			contentType: "application/merge-patch+json",
+			body:        map[string]any{"title": "Moana", "original_title": "Vaiana", "locale": "fr"},
+			status:      http.StatusOK,
+		},
+		{
+			name:        "merge patch of a read-only field",
+			contentType: "application/merge-patch+json",
+			body:        map[string]any{"poster": map[string]string{"original": "moana.jpg"}},
+			status:      http.StatusUnprocessableEntity,
+			errorField:  "poster",
+		},
+		{
+			name:        "merge patch with an unknown field",
+			contentType: "application/merge-patch+json",
+			body:        map[string]any{"director": "Ron Clements"},
+			status:      http.StatusUnprocessableEntity,
+			errorField:  "director",
+		},
+		{
+			name:        "merge patch with the wrong type",
+			contentType: "application/merge-patch+json",
+			body:        map[string]any{"year": "2016"},
+			status:      http.StatusUnprocessableEntity,
+			errorField:  "year",
+		},
+		{
+			name:        "json patch",
+			contentType: "application/json-patch+json",
+			body:        []map[string]any{{"op": "add", "path": "/genres/-", "value": "family"}},
+			status:      http.StatusOK,
+		},
+		{
+			name:        "json patch with a failed test",
+			contentType: "application/json-patch+json",
+			body:        []map[string]any{{"op": "test", "path": "/year", "value": 2015}, {"op": "replace", "path": "/year", "value": 2017}},
+			status:      http.StatusUnprocessableEntity,
+			errorField:  "patch",
+		},
+		{
+			name:        "json patch leaving an invalid movie",
+			contentType: "application/json-patch+json",
+			body:        []map[string]any{{"op": "remove", "path": "/title"}},
+			status:      http.StatusUnprocessableEntity,
+			errorField:  "title",
+		},
+		{
+			name:        "json patch of a missing member",
+			contentType: "application/json-patch+json",
+			body:        []map[string]any{{"op": "replace", "path": "/synopsis", "value": "A voyage."}},
+			status:      http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := ts.newRequest(t, http.MethodPatch, moviePath(id), token, tt.body)
+			req.Header.Set("Content-Type", tt.contentType)
+			resp := ts.send(t, req)
+			if resp.status != tt.status {
+				t.Fatalf("got status %d, want %d; body %v", resp.status, tt.status, resp.body)
+			}
+			if tt.errorField != "" {
+				if _, ok := field[map[string]any](t, resp.body, "error")[tt.errorField]; !ok {
+					t.Errorf("got errors %v, want one for %s", resp.body["error"], tt.errorField)
+				}
+			}
+		})
+	}
+
+	movie, err := app.models.Movies.Get(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movie.Year != 2016 || movie.Title != "Moana" || movie.Tagline != "The ocean is calling." || len(movie.Genres) != 2 {
+		t.Errorf("got %+v, want only the successful patches applied", movie)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"greenlight.darkhanomirbay/internal/jsonlog"
+	"greenlight.darkhanomirbay/internal/mailer"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// reloadableSettings are the settings that a reload applies to the running server.
+// Changes to any other setting are reported and take effect at the next restart.
+var reloadableSettings = map[string]bool{
+	"log-level":               true,
+	"limiter-rps":             true,
+	"limiter-burst":           true,
+	"anonymous-limiter-rps":   true,
+	"anonymous-limiter-burst": true,
+	"cors-trusted-origins":    true,
+	"smtp-host":               true,
+	"smtp-port":               true,
+	"smtp-username":           true,
+	"smtp-password":           true,
+	"smtp-sender":             true,
+}
+
+// currentConfig returns the configuration as last reloaded. It differs from app.config
+// only in the reloadable settings, and is replaced as a whole, so a request sees either
+// the old settings or the new ones.
+func (app *application) currentConfig() *config {
+	cfg := app.live.Load()
+	if cfg == nil {
+		return &app.config
+	}
+	return cfg
+}
+
+// reload reads the configuration again and applies the reloadable settings. A
+// configuration that fails to load or validate is rejected as a whole, and the server
+// carries on with the settings it has.
+func (app *application) reload() error {
+	cfg, err := app.loadConfig()
+	if err != nil {
+		return err
+	}
+	err = cfg.validate()
+	if err != nil {
+		return err
+	}
+
+	current := app.currentConfig()
+	next := *current
+	next.logLevel = cfg.logLevel
+	next.limiter.rps, next.limiter.burst = cfg.limiter.rps, cfg.limiter.burst
+	next.anonymous.rps, next.anonymous.burst = cfg.anonymous.rps, cfg.anonymous.burst
+	next.cors.trustedOrigins = cfg.cors.trustedOrigins
+	next.smtp = cfg.smtp
+	// The new values are checked against the settings that stay, such as whether the
+	// limiter is enabled, rather than against the ones that wait for a restart.
+	err = next.validate()
+	if err != nil {
+		return err
+	}
+
+	previous := app.loaded
+	if previous == nil {
+		previous = &app.config
+	}
+	before, loaded, after := settingValues(*current), settingValues(*previous), settingValues(cfg)
+	changed := make(map[string]string)
+	var restart []string
+	for name, value := range after {
+		switch {
+		case reloadableSettings[name]:
+			if value != before[name] {
+				changed[name] = fmt.Sprintf("%s -> %s", redact(name, before[name]), redact(name, value))
+			}
+		case value != loaded[name]:
+			restart = append(restart, name)
+		}
+	}
+
+	if next.smtp != current.smtp {
+		if m, ok := app.mailer.(*swappableMailer); ok {
+			m.store(newMailer(next))
+		}
+		app.smtpCheck.reset()
+	}
+	app.live.Store(&next)
+	app.loaded = &cfg
+
+	app.logger.PrintInfo("configuration reloaded", changed)
+	if len(restart) > 0 {
+		sort.Strings(restart)
+		app.logger.PrintInfo("changed settings take effect after a restart", map[string]string{
+			"settings": strings.Join(restart, ","),
+		})
+	}
+	level, _ := jsonlog.ParseLevel(next.logLevel)
+	app.logger.SetLevel(level)
+	return nil
+}
+
+// settingValues returns every setting of cfg by flag name, formatted as a flag value.
+func settingValues(cfg config) map[string]string {
+	var c config
+	fs := newFlagSet(&c)
+	// The flags write into c, so once it holds cfg they report its values.
+	c = cfg
+
+	values := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name != "config" {
+			values[f.Name] = f.Value.String()
+		}
+	})
+	return values
+}
+
+func newMailer(cfg config) mailer.Mailer {
+	return mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender)
+}
+
+// swappableMailer sends email with the mailer stored last, so that a reload can change
+// the SMTP settings while emails are being sent.
+type swappableMailer struct {
+	current atomic.Pointer[mailer.Mailer]
+}
+
+func newSwappableMailer(m mailer.Mailer) *swappableMailer {
+	s := &swappableMailer{}
+	s.store(m)
+	return s
+}
+
+func (s *swappableMailer) store(m mailer.Mailer) {
+	s.current.Store(&m)
+}
+
+func (s *swappableMailer) Send(ctx context.Context, recipient, templateFile string, data any) error {
+	return s.current.Load().Send(ctx, recipient, templateFile, data)
+}
+
+func (s *swappableMailer) Ping() error {
+	return s.current.Load().Ping()
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"greenlight.darkhanomirbay/internal/jsonlog"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// reloadFrom makes app reload the configuration given by args, on top of the settings
+// for in-memory storage.
+func reloadFrom(app *application, args ...string) {
+	app.loadConfig = func() (config, error) {
+		cfg, _, err := loadConfig(append([]string{"-storage", "memory"}, args...), func(string) string { return "" })
+		return cfg, err
+	}
+}
+
+func TestReload(t *testing.T) {
+	app, _ := newTestApplication(t)
+	var logs lockedBuffer
+	app.logger = jsonlog.New(&logs, jsonlog.LevelInfo)
+
+	reloadFrom(app, "-limiter-rps", "0.001", "-limiter-burst", "1")
+	cfg, err := app.loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.config = cfg
+	app.mailer = newSwappableMailer(newMailer(cfg))
+	ts := newTestServer(t, app)
+
+	ts.mustDo(t, http.StatusOK, http.MethodGet, "/livez", "", nil)
+	ts.mustDo(t, http.StatusTooManyRequests, http.MethodGet, "/livez", "", nil)
+
+	reloadFrom(app, "-limiter-rps", "1000", "-limiter-burst", "10", "-cors-trusted-origins", "https://example.com",
+		"-smtp-host", "smtp.example.com", "-smtp-password", "pa55word", "-log-level", "error", "-port", "5000")
+	mailer := app.mailer.(*swappableMailer).current.Load()
+	err = app.reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The client that was over its limit gets the new one.
+	ts.mustDo(t, http.StatusOK, http.MethodGet, "/livez", "", nil)
+
+	req, err := http.NewRequest(http.MethodOptions, ts.URL+"/v1/movies", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPatch)
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if got := res.Header.Get("Access-Control-Allow-Origin"); got != "https://example.com" {
+		t.Errorf("got Access-Control-Allow-Origin %q, want https://example.com", got)
+	}
+
+	if app.logger.Level() != jsonlog.LevelError {
+		t.Errorf("got log level %s, want ERROR", app.logger.Level())
+	}
+	if app.mailer.(*swappableMailer).current.Load() == mailer {
+		t.Error("the mailer was not replaced")
+	}
+	if got := app.currentConfig().port; got != 4000 {
+		t.Errorf("got port %d, want 4000 until a restart", got)
+	}
+
+	out := logs.String()
+	for _, want := range []string{`"limiter-rps":"0.001 -\u003e 1000"`, `"smtp-password":" -\u003e REDACTED"`, `"settings":"blob-base-url,port"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("the logs do not contain %s:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "pa55word") {
+		t.Errorf("a secret was logged:\n%s", out)
+	}
+
+}
+
+func TestReloadReportsRestartSettingsOnce(t *testing.T) {
+	app, _ := newTestApplication(t)
+	var logs lockedBuffer
+	app.logger = jsonlog.New(&logs, jsonlog.LevelInfo)
+	reloadFrom(app)
+	cfg, err := app.loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.config = cfg
+
+	reloadFrom(app, "-port", "5000")
+	for i, want := range []bool{true, false} {
+		logs.Reset()
+		err = app.reload()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Contains(logs.String(), "after a restart"); got != want {
+			t.Errorf("reload %d: got port reported %t, want %t:\n%s", i+1, got, want, logs.String())
+		}
+	}
+
+	logs.Reset()
+	reloadFrom(app, "-port", "4000")
+	err = app.reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "after a restart") {
+		t.Errorf("changing the port back wasn't reported:\n%s", logs.String())
+	}
+}
+
+func TestReloadRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{name: "load error", args: []string{"-limiter-rps", "fast"}, err: "limiter-rps"},
+		{name: "invalid", args: []string{"-limiter-rps", "0", "-log-level", "error"}, err: "limiter-rps: must be positive"},
+		{name: "invalid origin", args: []string{"-cors-trusted-origins", "https://example.com/app"}, err: "cors-trusted-origins"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, _ := newTestApplication(t)
+			reloadFrom(app)
+			cfg, err := app.loadConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			app.config = cfg
+
+			reloadFrom(app, tt.args...)
+			err = app.reload()
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("got error %v, want one containing %q", err, tt.err)
+			}
+			if app.currentConfig() != &app.config {
+				t.Error("the rejected configuration was applied")
+			}
+			if app.logger.Level() != jsonlog.LevelInfo {
+				t.Errorf("got log level %s, want INFO", app.logger.Level())
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"greenlight.darkhanomirbay/internal/data"
+	"greenlight.darkhanomirbay/internal/validator"
+	"net/http"
+)
+
+func (app *application) listMovieRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	movie, ok := app.readMovie(w, r)
+	if !ok {
+		return
+	}
+	var filters data.Filters
+	v := validator.New()
+	qs := r.URL.Query()
+
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	filters.Sort = app.readString(qs, "sort", "-version")
+	filters.SortSafeList = []string{"version", "-version"}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	revisions, metadata, err := app.models.Revisions.GetAllForMovie(r.Context(), movie.ID, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	hideEditorFields(app.contextGetUser(r), revisions...)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"revisions": revisions, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// diffMovieRevisionsHandler compares two revisions of a movie. The to version defaults
+// to the current one.
+func (app *application) diffMovieRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	movie, ok := app.readMovie(w, r)
+	if !ok {
+		return
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	from := app.readInt(qs, "from", 0, v)
+	to := app.readInt(qs, "to", int(movie.Version), v)
+	v.Check(from > 0, "from", "must be provided")
+	v.Check(to > 0, "to", "must be greater than zero")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var revisions [2]*data.MovieRevision
+	for i, version := range []int{from, to} {
+		revision, err := app.models.Revisions.Get(r.Context(), movie.ID, int32(version))
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		// The runtime change in the diff is nested too deep for writeJSON to format.
+		revision.SetRuntimeFormat(responseRuntimeFormat(w))
+		revisions[i] = revision
+	}
+
+	env := envelope{"diff": map[string]any{
+		"movie_id": movie.ID,
+		"from":     from,
+		"to":       to,
+		"changes":  data.Diff(revisions[0], revisions[1]),
+	}}
+	err := app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// restoreMovieRevisionHandler saves the snapshot from an earlier revision as a new
+// version of the movie.
+func (app *application) restoreMovieRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	movie, ok := app.readMovie(w, r)
+	if !ok {
+		return
+	}
+	version, err := app.readIntParam(r, "version")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	revision, err := app.models.Revisions.Get(r.Context(), movie.ID, int32(version))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	revision.ApplyTo(movie)
+
+	v := validator.New()
+	if data.ValidateMovie(v, movie); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Movies.Update(r.Context(), movie, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateExternalID):
+			v.AddError("external_ids", "a movie with one of these external ids already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRevisionsCoverMetadata(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+	token := ts.newUser(t, "writer@example.com", "movies:write")
+
+	resp := ts.mustDo(t, http.StatusCreated, http.MethodPost, "/v1/movies", token, map[string]any{
+		"title":   "Moana",
+		"year":    2016,
+		"runtime": 107,
+		"genres":  []string{"animation"},
+		"tagline": "The ocean is calling.",
+	})
+	path := moviePath(int64(field[float64](t, resp.body, "movie", "id")))
+
+	ts.mustDo(t, http.StatusOK, http.MethodPatch, path, token, map[string]any{
+		"tagline":        "Make way.",
+		"certifications": map[string]string{"US": "PG"},
+		"external_ids":   map[string]string{"imdb": "tt3521164"},
+	})
+
+	resp = ts.mustDo(t, http.StatusOK, http.MethodGet, path+"/diff?from=1&to=2", token, nil)
+	changes := field[map[string]any](t, resp.body, "diff", "changes")
+	for _, name := range []string{"tagline", "certifications", "external_ids"} {
+		if _, ok := changes[name]; !ok {
+			t.Errorf("the diff does not include %s: %v", name, changes)
+		}
+	}
+	if got := field[string](t, resp.body, "diff", "changes", "tagline", "to"); got != "Make way." {
+		t.Errorf("got tagline changed to %q, want Make way.", got)
+	}
+	if len(changes) != 3 {
+		t.Errorf("got %d changes, want 3: %v", len(changes), changes)
+	}
+
+	resp = ts.mustDo(t, http.StatusOK, http.MethodPost, path+"/revisions/1/restore", token, nil)
+	if got := field[string](t, resp.body, "movie", "tagline"); got != "The ocean is calling." {
+		t.Errorf("got tagline %q after the restore, want The ocean is calling.", got)
+	}
+	movie := field[map[string]any](t, resp.body, "movie")
+	for _, name := range []string{"certifications", "external_ids"} {
+		if value, ok := movie[name]; ok {
+			t.Errorf("got %s %v after the restore, want none", name, value)
+		}
+	}
+}
+
+func TestDiffRuntimeFormat(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+	token := ts.newUser(t, "writer@example.com", "movies:write")
+
+	resp := ts.mustDo(t, http.StatusCreated, http.MethodPost, "/v1/movies", token, map[string]any{
+		"title":   "Moana",
+		"year":    2016,
+		"runtime": 107,
+		"genres":  []string{"animation"},
+	})
+	path := moviePath(int64(field[float64](t, resp.body, "movie", "id")))
+	ts.mustDo(t, http.StatusOK, http.MethodPatch, path, token, map[string]any{"runtime": 102})
+
+	resp = ts.mustDo(t, http.StatusOK, http.MethodGet, path+"/diff?from=1&runtime_format=human", token, nil)
+	if got := field[string](t, resp.body, "diff", "changes", "runtime", "from"); got != "1h 47m" {
+		t.Errorf("got runtime changed from %q, want 1h 47m", got)
+	}
+	if got := field[string](t, resp.body, "diff", "changes", "runtime", "to"); got != "1h 42m" {
+		t.Errorf("got runtime changed to %q, want 1h 42m", got)
+	}
+}
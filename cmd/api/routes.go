@@ -1,26 +1,61 @@
 package main
 
 import (
-	"github.com/julienschmidt/httprouter"
 	"net/http"
 )
 
 func (app *application) routes() http.Handler {
 
-	router := httprouter.New()
+	router := newPatternRouter()
 	router.NotFound = http.HandlerFunc(app.notFoundResponse)
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 
 	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requirePermission("movies:read", app.listMoviesHandler))
 	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission("movies:write", app.createMovieHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requirePermission("movies:read", app.showMovieHandler))
+	router.staticID(http.MethodPost, "/v1/movies/:id", app.methodNotAllowedResponse, map[string]http.HandlerFunc{
+		"import": app.requirePermission("movies:write", app.importMoviesHandler),
+	})
+	router.staticID(http.MethodGet, "/v1/movies/:id", app.requirePermission("movies:read", app.showMovieHandler), map[string]http.HandlerFunc{
+		"export": app.requirePermission("movies:read", app.exportMoviesHandler),
+		"trash":  app.requirePermission("movies:write", app.listTrashedMoviesHandler),
+	})
 	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission("movies:write", app.updateMovieHandler))
 	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermission("movies:write", app.deleteMovieHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/restore", app.requirePermission("movies:write", app.restoreMovieHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/purge", app.requirePermission("movies:purge", app.purgeMovieHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions", app.requirePermission("movies:read", app.listMovieRevisionsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/diff", app.requirePermission("movies:read", app.diffMovieRevisionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/revisions/:version/restore", app.requirePermission("movies:write", app.restoreMovieRevisionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/similar", app.requirePermission("movies:read", app.listSimilarMoviesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/merge", app.requirePermission("movies:write", app.mergeMovieHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/translations", app.requirePermission("movies:read", app.listMovieTranslationsHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/translations/:locale", app.requirePermission("movies:write", app.putMovieTranslationHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/translations/:locale", app.requirePermission("movies:write", app.deleteMovieTranslationHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/poster", app.requirePermission("movies:write", app.uploadArtworkHandler(posterArtwork)))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/poster", app.requirePermission("movies:write", app.deleteArtworkHandler(posterArtwork)))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/backdrop", app.requirePermission("movies:write", app.uploadArtworkHandler(backdropArtwork)))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/backdrop", app.requirePermission("movies:write", app.deleteArtworkHandler(backdropArtwork)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/collections", app.requirePermission("movies:read", app.listCollectionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/collections", app.requirePermission("movies:write", app.createCollectionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/collections/:id", app.requirePermission("movies:read", app.showCollectionHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/collections/:id", app.requirePermission("movies:write", app.updateCollectionHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/collections/:id", app.requirePermission("movies:write", app.deleteCollectionHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/stats/movies", app.requirePermission("movies:read", app.movieStatsHandler))
+
+	if app.config.blob.backend == "local" {
+		router.HandlerFunc(http.MethodGet, "/blobs/*filepath", app.serveBlobHandler)
+	}
+
+	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+	router.HandlerFunc(http.MethodGet, "/livez", app.livenessHandler)
+	router.HandlerFunc(http.MethodGet, "/readyz", app.readinessHandler)
 
 	//USER
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
 
-	return app.recoverPanic(app.rateLimit(app.authenticate(router)))
+	return app.requestID(app.instrument(router, app.trace(router, app.logRequests(router, app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(app.runtimeFormat(router)))))))))
 }
@@ -4,46 +4,104 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 )
 
 func (app *application) serve() error {
+	// Requests and background jobs run in a context that is cancelled once the grace
+	// period for draining them at shutdown is over, so that their queries are abandoned
+	// rather than left running.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", app.config.port),
 		Handler:      app.routes(),
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
 	}
+	admin := app.adminServer()
+
 	shutdownError := make(chan error)
 	go func() {
 		quit := make(chan os.Signal, 1)
 		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 		s := <-quit
+		app.shuttingDown.Store(true)
 		app.logger.PrintInfo("shutting down server", map[string]string{"signal": s.String()})
-		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-		defer cancel()
-		err := srv.Shutdown(ctx)
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer shutdownCancel()
+		err := srv.Shutdown(shutdownCtx)
+		cancel()
 		if err != nil {
 			shutdownError <- err
+			return
+		}
+		if admin != nil {
+			err = admin.Shutdown(shutdownCtx)
+			if err != nil {
+				shutdownError <- err
+				return
+			}
 		}
 		app.logger.PrintInfo("completing background tasks", map[string]string{
 			"addr": srv.Addr,
 		})
 
-		shutdownError <- srv.Shutdown(ctx)
+		// Stop the periodic jobs and wait for them and any other background goroutines.
+		close(app.shutdown)
+		app.wg.Wait()
+		shutdownError <- nil
 	}()
 
+	// SIGHUP reloads the configuration, applying the settings that can change while the
+	// server runs.
+	go func() {
+		hangup := make(chan os.Signal, 1)
+		signal.Notify(hangup, syscall.SIGHUP)
+		defer signal.Stop(hangup)
+		for {
+			select {
+			case <-hangup:
+				err := app.reload()
+				if err != nil {
+					app.logger.PrintError(fmt.Errorf("configuration reload rejected: %w", err), nil)
+				}
+			case <-app.shutdown:
+				return
+			}
+		}
+	}()
+
+	app.backgroundJob(ctx, "purge trash", app.config.trash.purgeInterval, app.purgeTrash)
+	app.backgroundJob(ctx, "refresh movie stats", app.config.stats.refreshInterval, app.models.Stats.RefreshMovieStats)
+
+	if admin != nil {
+		go func() {
+			app.logger.PrintInfo("starting admin server", map[string]string{"addr": admin.Addr})
+			err := admin.ListenAndServe()
+			if !errors.Is(err, http.ErrServerClosed) {
+				app.logger.PrintError(err, map[string]string{"addr": admin.Addr})
+			}
+		}()
+	}
+
 	app.logger.PrintInfo("starting server", map[string]string{
 		"Addr": srv.Addr,
 		"env":  app.config.env,
 	})
 	err := srv.ListenAndServe()
-	if errors.Is(err, http.ErrServerClosed) {
+	if !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
 	err = <-shutdownError
@@ -56,3 +114,21 @@ func (app *application) serve() error {
 	})
 	return nil
 }
+
+// adminServer returns the server for the admin port, which serves the Prometheus
+// metrics at /metrics, or nil if the admin port is disabled.
+func (app *application) adminServer() *http.Server {
+	if app.config.admin.port == 0 {
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", app.metrics.handler())
+
+	return &http.Server{
+		Addr:         net.JoinHostPort(app.config.admin.host, strconv.Itoa(app.config.admin.port)),
+		Handler:      mux,
+		IdleTimeout:  time.Minute,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+}
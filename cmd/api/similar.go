@@ -0,0 +1,39 @@
+package main
+
+import (
+	"greenlight.darkhanomirbay/internal/data"
+	"greenlight.darkhanomirbay/internal/validator"
+	"net/http"
+)
+
+func (app *application) listSimilarMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	movie, ok := app.readMovie(w, r)
+	if !ok {
+		return
+	}
+	var filters data.Filters
+	v := validator.New()
+	qs := r.URL.Query()
+
+	// Similar movies are always ranked by similarity, so there is nothing to sort by.
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 10, v)
+	filters.Sort = "-similarity"
+	filters.SortSafeList = []string{"-similarity"}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	movies, metadata, err := app.models.Movies.GetSimilar(r.Context(), movie, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	hideEditorFields(app.contextGetUser(r), movies...)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movies": movies, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
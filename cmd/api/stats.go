@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"greenlight.darkhanomirbay/internal/data"
+	"net/http"
+)
+
+func (app *application) movieStatsHandler(w http.ResponseWriter, r *http.Request) {
+	stats, err := app.models.Stats.GetMovieStats(r.Context())
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// The statistics only change when the view is refreshed, so clients may reuse them
+	// until the next refresh is due.
+	headers := make(http.Header)
+	headers.Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(app.config.stats.refreshInterval.Seconds())))
+	headers.Set("Last-Modified", stats.RefreshedAt.UTC().Format(http.TimeFormat))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"stats": stats}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"greenlight.darkhanomirbay/internal/data"
+	"greenlight.darkhanomirbay/internal/jsonlog"
+	"greenlight.darkhanomirbay/internal/storage"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// sentEmail is an email the fake mailer was asked to send.
+type sentEmail struct {
+	recipient    string
+	templateFile string
+	data         any
+}
+
+// fakeMailer records emails instead of sending them. Ping fails with pingErr if it is
+// set.
+type fakeMailer struct {
+	mu      sync.Mutex
+	sent    []sentEmail
+	pingErr error
+}
+
+func (m *fakeMailer) Send(ctx context.Context, recipient, templateFile string, data any) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, sentEmail{recipient: recipient, templateFile: templateFile, data: data})
+	return nil
+}
+
+func (m *fakeMailer) Ping() error {
+	return m.pingErr
+}
+
+// lastTo returns the last email sent to recipient.
+func (m *fakeMailer) lastTo(t *testing.T, recipient string) sentEmail {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.sent) - 1; i >= 0; i-- {
+		if m.sent[i].recipient == recipient {
+			return m.sent[i]
+		}
+	}
+	t.Fatalf("no email was sent to %s", recipient)
+	return sentEmail{}
+}
+
+// lockedBuffer is a buffer that the server goroutines can log to while the test reads
+// it.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *lockedBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Reset()
+}
+
+// newTestApplication returns an application backed by in-memory storage and a fake
+// mailer, configured like a development server with the rate limiter turned off.
+func newTestApplication(t *testing.T) (*application, *fakeMailer) {
+	t.Helper()
+
+	var cfg config
+	cfg.env = "testing"
+	cfg.limiter.rps = 2
+	cfg.limiter.burst = 4
+	cfg.anonymous.permissions = data.Permissions{"movies:read"}
+	cfg.anonymous.rps = 1
+	cfg.anonymous.burst = 2
+	cfg.blob.backend = "local"
+	cfg.blob.localDir = t.TempDir()
+	cfg.posters.maxBytes = 1 << 20
+
+	mailer := &fakeMailer{}
+	app := &application{
+		config:   cfg,
+		logger:   jsonlog.New(io.Discard, jsonlog.LevelInfo),
+		models:   data.NewMemoryModels(),
+		mailer:   mailer,
+		blobs:    storage.NewLocalStore(cfg.blob.localDir, "http://localhost/blobs"),
+		shutdown: make(chan struct{}),
+	}
+	app.metrics = newMetrics(nil, &app.backgroundTasks)
+	return app, mailer
+}
+
+// testServer serves the routes of an application over a real connection.
+type testServer struct {
+	*httptest.Server
+	app *application
+}
+
+func newTestServer(t *testing.T, app *application) *testServer {
+	t.Helper()
+	ts := httptest.NewServer(app.routes())
+	t.Cleanup(func() {
+		ts.Close()
+		app.wg.Wait()
+	})
+	return &testServer{Server: ts, app: app}
+}
+
+// response is a response read in full by testServer.do.
+type response struct {
+	status int
+	header http.Header
+	body   map[string]any
+}
+
+// newRequest returns a request with body encoded as JSON, authenticated with token
+// unless it is empty.
+func (ts *testServer) newRequest(t *testing.T, method, path, token string, body any) *http.Request {
+	t.Helper()
+
+	var reqBody io.Reader
+	if body != nil {
+		js, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reqBody = bytes.NewReader(js)
+	}
+	req, err := http.NewRequest(method, ts.URL+path, reqBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+// send sends req and decodes the JSON response.
+func (ts *testServer) send(t *testing.T, req *http.Request) response {
+	t.Helper()
+
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	resp := response{status: res.StatusCode, header: res.Header}
+	js, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(js) > 0 {
+		err = json.Unmarshal(js, &resp.body)
+		if err != nil {
+			t.Fatalf("%s %s: decoding %q: %s", req.Method, req.URL.Path, js, err)
+		}
+	}
+	return resp
+}
+
+// do sends a request with body encoded as JSON, authenticated with token unless it is
+// empty, and decodes the JSON response.
+func (ts *testServer) do(t *testing.T, method, path, token string, body any) response {
+	t.Helper()
+	return ts.send(t, ts.newRequest(t, method, path, token, body))
+}
+
+// mustDo is like do, but fails the test unless the response has the wanted status.
+func (ts *testServer) mustDo(t *testing.T, want int, method, path, token string, body any) response {
+	t.Helper()
+	resp := ts.do(t, method, path, token, body)
+	if resp.status != want {
+		t.Fatalf("%s %s: got status %d, want %d; body %v", method, path, resp.status, want, resp.body)
+	}
+	return resp
+}
+
+// registerUser registers a user and returns their id and activation token.
+func (ts *testServer) registerUser(t *testing.T, email, password string) (int64, string) {
+	t.Helper()
+	resp := ts.mustDo(t, http.StatusCreated, http.MethodPost, "/v1/users", "", map[string]any{
+		"name":     "Test User",
+		"email":    email,
+		"password": password,
+	})
+	id := int64(field[float64](t, resp.body, "user", "id"))
+
+	// The welcome email is sent in the background after the response.
+	ts.app.wg.Wait()
+	welcome := ts.app.mailer.(*fakeMailer).lastTo(t, email)
+	if welcome.templateFile != "user_welcome.tmpl" {
+		t.Fatalf("got template %q, want user_welcome.tmpl", welcome.templateFile)
+	}
+	return id, welcome.data.(map[string]any)["activationToken"].(string)
+}
+
+// authenticate returns an authentication token for the user.
+func (ts *testServer) authenticate(t *testing.T, email, password string) string {
+	t.Helper()
+	resp := ts.mustDo(t, http.StatusCreated, http.MethodPost, "/v1/tokens/authentication", "", map[string]any{
+		"email":    email,
+		"password": password,
+	})
+	return field[string](t, resp.body, "authentication token", "token")
+}
+
+// newUser registers and activates a user with the given permissions, besides the
+// movies:read permission every user gets, and returns an authentication token for them.
+func (ts *testServer) newUser(t *testing.T, email string, permissions ...string) string {
+	t.Helper()
+	id, activation := ts.registerUser(t, email, "pa55word1234")
+	ts.mustDo(t, http.StatusOK, http.MethodPut, "/v1/users/activated", "", map[string]any{"token": activation})
+	err := ts.app.models.Permissions.AddForUser(context.Background(), id, permissions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts.authenticate(t, email, "pa55word1234")
+}
+
+// field returns the value at the path of keys in a decoded JSON object.
+func field[T any](t *testing.T, body map[string]any, path ...string) T {
+	t.Helper()
+	var value any = body
+	for _, key := range path {
+		object, ok := value.(map[string]any)
+		if !ok {
+			t.Fatalf("%v: %s is not inside an object", body, key)
+		}
+		value = object[key]
+	}
+	typed, ok := value.(T)
+	if !ok {
+		var zero T
+		t.Fatalf("%v: %v is %T, want %T", body, path, value, zero)
+	}
+	return typed
+}
+
+func moviePath(id int64) string {
+	return fmt.Sprintf("/v1/movies/%d", id)
+}
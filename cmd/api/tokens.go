@@ -25,7 +25,7 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	user, err := app.models.Users.GetByEmail(input.Email)
+	user, err := app.models.Users.GetByEmail(r.Context(), input.Email)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -33,6 +33,7 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
+		return
 	}
 	match, err := user.Password.Matches(input.Password)
 	if err != nil {
@@ -44,9 +45,10 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	token, err := app.models.Tokens.New(r.Context(), user.ID, 24*time.Hour, data.ScopeAuthentication)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+		return
 	}
 	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication token": token}, nil)
 	if err != nil {
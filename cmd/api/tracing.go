@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+var tracer = otel.Tracer("greenlight.darkhanomirbay/cmd/api")
+
+// setupTracing installs the W3C trace context propagator and, if an OTLP endpoint is
+// configured, a tracer provider that exports spans to it over OTLP/HTTP. Without an
+// endpoint spans are not recorded, but trace IDs received in traceparent headers are
+// still passed on and logged. The returned function flushes and stops the exporter.
+func setupTracing(cfg config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if cfg.otlp.endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	endpoint, err := url.Parse(cfg.otlp.endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q", cfg.otlp.endpoint)
+	}
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint.Host)}
+	if endpoint.Scheme == "http" {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	if endpoint.Path != "" && endpoint.Path != "/" {
+		options = append(options, otlptracehttp.WithURLPath(endpoint.Path))
+	}
+	exporter, err := otlptracehttp.New(context.Background(), options...)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName("greenlight"),
+		semconv.ServiceVersion(version),
+		semconv.DeploymentEnvironment(cfg.env),
+	))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.otlp.sampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// trace starts a server span for each request, continuing the trace named in the
+// traceparent header if there is one. Spans are named after the route rather than the
+// URL, so that requests for different movies are grouped together.
+func (app *application) trace(router *patternRouter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		route := router.Pattern(r)
+		client := r.RemoteAddr
+		if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			client = ip
+		}
+		ctx, span := tracer.Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethod(r.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(r.URL.Path),
+				semconv.ClientAddress(client),
+				semconv.UserAgentOriginal(r.UserAgent()),
+			),
+		)
+		defer span.End()
+
+		sw := newStatusResponseWriter(w)
+		defer func() {
+			aborted := recover()
+			span.SetAttributes(semconv.HTTPStatusCode(sw.statusCode))
+			switch {
+			case aborted != nil:
+				span.SetStatus(codes.Error, "response aborted")
+				panic(aborted)
+			case sw.statusCode >= 500:
+				span.SetStatus(codes.Error, http.StatusText(sw.statusCode))
+			}
+		}()
+		next.ServeHTTP(sw, r.WithContext(ctx))
+	})
+}
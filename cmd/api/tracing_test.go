@@ -0,0 +1,51 @@
+package main
+
+import (
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+var (
+	spanRecorderOnce sync.Once
+	spanRecorder     *tracetest.SpanRecorder
+)
+
+// recordSpans returns a recorder of the spans ended by the package tracer. The tracer
+// is bound to the first provider installed, so every test shares one recorder.
+func recordSpans() *tracetest.SpanRecorder {
+	spanRecorderOnce.Do(func() {
+		spanRecorder = tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)))
+	})
+	return spanRecorder
+}
+
+func TestTraceClientAddress(t *testing.T) {
+	recorder := recordSpans()
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+	ts.mustDo(t, http.StatusOK, http.MethodGet, "/livez", "", nil)
+	// Close waits for the handler to return, so that the span has ended.
+	ts.Close()
+
+	found := false
+	for _, span := range recorder.Ended() {
+		if span.Name() != "GET /livez" {
+			continue
+		}
+		found = true
+		for _, attr := range span.Attributes() {
+			if attr.Key == semconv.ClientAddressKey && attr.Value.AsString() != "127.0.0.1" {
+				t.Errorf("got client address %q, want the IP without the port", attr.Value.AsString())
+			}
+		}
+	}
+	if !found {
+		t.Fatal("no span was recorded for the request")
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestTrashCycle(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+	writer := ts.newUser(t, "writer@example.com", "movies:write")
+	purger := ts.newUser(t, "purger@example.com", "movies:write", "movies:purge")
+
+	resp := ts.mustDo(t, http.StatusCreated, http.MethodPost, "/v1/movies", writer, map[string]any{
+		"title": "Moana", "year": 2016, "runtime": 107, "genres": []string{"animation"},
+	})
+	path := moviePath(int64(field[float64](t, resp.body, "movie", "id")))
+
+	// Each step runs against the state the steps before it left behind.
+	steps := []struct {
+		name    string
+		method  string
+		path    string
+		token   string
+		status  int
+		trashed int
+	}{
+		{name: "purge a live movie", method: http.MethodPost, path: path + "/purge", token: purger, status: http.StatusNotFound, trashed: 0},
+		{name: "restore a live movie", method: http.MethodPost, path: path + "/restore", token: writer, status: http.StatusNotFound, trashed: 0},
+		{name: "delete", method: http.MethodDelete, path: path, token: writer, status: http.StatusOK, trashed: 1},
+		{name: "show a trashed movie", method: http.MethodGet, path: path, token: writer, status: http.StatusNotFound, trashed: 1},
+		{name: "delete a trashed movie", method: http.MethodDelete, path: path, token: writer, status: http.StatusNotFound, trashed: 1},
+		{name: "restore", method: http.MethodPost, path: path + "/restore", token: writer, status: http.StatusOK, trashed: 0},
+		{name: "show a restored movie", method: http.MethodGet, path: path, token: writer, status: http.StatusOK, trashed: 0},
+		{name: "delete again", method: http.MethodDelete, path: path, token: writer, status: http.StatusOK, trashed: 1},
+		{name: "purge without permission", method: http.MethodPost, path: path + "/purge", token: writer, status: http.StatusForbidden, trashed: 1},
+		{name: "purge", method: http.MethodPost, path: path + "/purge", token: purger, status: http.StatusOK, trashed: 0},
+		{name: "restore a purged movie", method: http.MethodPost, path: path + "/restore", token: writer, status: http.StatusNotFound, trashed: 0},
+		{name: "purge a purged movie", method: http.MethodPost, path: path + "/purge", token: purger, status: http.StatusNotFound, trashed: 0},
+	}
+	for _, step := range steps {
+		resp := ts.do(t, step.method, step.path, step.token, nil)
+		if resp.status != step.status {
+			t.Fatalf("%s: got status %d, want %d; body %v", step.name, resp.status, step.status, resp.body)
+		}
+
+		resp = ts.mustDo(t, http.StatusOK, http.MethodGet, "/v1/movies/trash", writer, nil)
+		if got := len(field[[]any](t, resp.body, "movies")); got != step.trashed {
+			t.Fatalf("after %s: got %d movies in the trash, want %d", step.name, got, step.trashed)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRegisterUser(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	id, activation := ts.registerUser(t, "alice@example.com", "pa55word1234")
+	if id < 1 {
+		t.Errorf("got id %d, want a positive id", id)
+	}
+	if len(activation) != 26 {
+		t.Errorf("got activation token %q, want 26 characters", activation)
+	}
+
+	tests := []struct {
+		name  string
+		body  map[string]any
+		field string
+	}{
+		{name: "missing name", body: map[string]any{"email": "bob@example.com", "password": "pa55word1234"}, field: "name"},
+		{name: "invalid email", body: map[string]any{"name": "Bob", "email": "bob", "password": "pa55word1234"}, field: "email"},
+		{name: "short password", body: map[string]any{"name": "Bob", "email": "bob@example.com", "password": "short"}, field: "password"},
+		{name: "duplicate email", body: map[string]any{"name": "Alice", "email": "alice@example.com", "password": "pa55word1234"}, field: "email"},
+		{name: "duplicate email in another case", body: map[string]any{"name": "Alice", "email": "ALICE@example.com", "password": "pa55word1234"}, field: "email"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := ts.mustDo(t, http.StatusUnprocessableEntity, http.MethodPost, "/v1/users", "", tt.body)
+			if message := field[string](t, resp.body, "error", tt.field); message == "" {
+				t.Errorf("got no error for %s", tt.field)
+			}
+		})
+	}
+
+	t.Run("unknown field", func(t *testing.T) {
+		resp := ts.mustDo(t, http.StatusBadRequest, http.MethodPost, "/v1/users", "", map[string]any{"name": "Bob", "admin": true})
+		if got, want := field[string](t, resp.body, "error"), `body contains unknown key "admin"`; got != want {
+			t.Errorf("got error %q, want %q", got, want)
+		}
+	})
+}
+
+func TestActivateUser(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	_, activation := ts.registerUser(t, "alice@example.com", "pa55word1234")
+
+	resp := ts.mustDo(t, http.StatusUnprocessableEntity, http.MethodPut, "/v1/users/activated", "", map[string]any{"token": "ABCDEFGHIJKLMNOPQRSTUVWXYZ"})
+	if got, want := field[string](t, resp.body, "error", "token"), "invalid or expired activation token"; got != want {
+		t.Errorf("got error %q, want %q", got, want)
+	}
+	ts.mustDo(t, http.StatusUnprocessableEntity, http.MethodPut, "/v1/users/activated", "", map[string]any{"token": "short"})
+
+	resp = ts.mustDo(t, http.StatusOK, http.MethodPut, "/v1/users/activated", "", map[string]any{"token": activation})
+	if !field[bool](t, resp.body, "user", "activated") {
+		t.Error("the user was not activated")
+	}
+
+	// Activation tokens are deleted once used.
+	ts.mustDo(t, http.StatusUnprocessableEntity, http.MethodPut, "/v1/users/activated", "", map[string]any{"token": activation})
+}
+
+func TestAuthentication(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	ts.registerUser(t, "alice@example.com", "pa55word1234")
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		want     int
+	}{
+		{name: "valid credentials", email: "alice@example.com", password: "pa55word1234", want: http.StatusCreated},
+		{name: "wrong password", email: "alice@example.com", password: "wrongpassword", want: http.StatusUnauthorized},
+		{name: "unknown email", email: "bob@example.com", password: "pa55word1234", want: http.StatusUnauthorized},
+		{name: "invalid email", email: "alice", password: "pa55word1234", want: http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts.mustDo(t, tt.want, http.MethodPost, "/v1/tokens/authentication", "", map[string]any{
+				"email":    tt.email,
+				"password": tt.password,
+			})
+		})
+	}
+
+	t.Run("invalid tokens", func(t *testing.T) {
+		resp := ts.mustDo(t, http.StatusUnauthorized, http.MethodGet, "/v1/movies", "ABCDEFGHIJKLMNOPQRSTUVWXYZ", nil)
+		if got := resp.header.Get("WWW-Authenticate"); got != "Bearer" {
+			t.Errorf("got WWW-Authenticate %q, want Bearer", got)
+		}
+		ts.mustDo(t, http.StatusUnauthorized, http.MethodGet, "/v1/movies", "short", nil)
+	})
+}
+
+func TestPermissions(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	ts.registerUser(t, "inactive@example.com", "pa55word1234")
+	inactive := ts.authenticate(t, "inactive@example.com", "pa55word1234")
+	reader := ts.newUser(t, "reader@example.com")
+	writer := ts.newUser(t, "writer@example.com", "movies:write")
+
+	movie := map[string]any{"title": "Moana", "year": 2016, "runtime": 107, "genres": []string{"animation"}}
+	tests := []struct {
+		name   string
+		method string
+		token  string
+		body   any
+		want   int
+	}{
+		{name: "anonymous read", method: http.MethodGet, want: http.StatusUnauthorized},
+		{name: "inactive read", method: http.MethodGet, token: inactive, want: http.StatusForbidden},
+		{name: "reader read", method: http.MethodGet, token: reader, want: http.StatusOK},
+		{name: "reader write", method: http.MethodPost, token: reader, body: movie, want: http.StatusForbidden},
+		{name: "writer write", method: http.MethodPost, token: writer, body: movie, want: http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts.mustDo(t, tt.want, tt.method, "/v1/movies", tt.token, tt.body)
+		})
+	}
+
+	t.Run("anonymous mode", func(t *testing.T) {
+		// Switch modes the way a reload does, by storing a new configuration.
+		cfg := *app.currentConfig()
+		cfg.anonymous.enabled = true
+		app.live.Store(&cfg)
+		defer app.live.Store(nil)
+
+		ts.mustDo(t, http.StatusOK, http.MethodGet, "/v1/movies", "", nil)
+		ts.mustDo(t, http.StatusUnauthorized, http.MethodPost, "/v1/movies", "", movie)
+	})
+}
@@ -0,0 +1,69 @@
+package data
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Artwork maps an image size, such as "original" or "w185", to the URL the image is
+// served from. Posters and backdrops are both kept this way.
+type Artwork map[string]string
+
+func (a *Artwork) Scan(src any) error {
+	switch src := src.(type) {
+	case nil:
+		*a = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(src, a)
+	case string:
+		return json.Unmarshal([]byte(src), a)
+	default:
+		return errors.New("unsupported artwork value")
+	}
+}
+func (a Artwork) Value() (driver.Value, error) {
+	if len(a) == 0 {
+		return nil, nil
+	}
+	js, err := json.Marshal(a)
+	return string(js), err
+}
+
+// SetPoster stores the poster key and URLs of the movie. It doesn't bump the version,
+// as artwork is managed separately from the movie details.
+func (m *MovieModel) SetPoster(ctx context.Context, movie *Movie) (err error) {
+	ctx, endSpan := startSpan(ctx, "MovieModel.SetPoster")
+	defer endSpan(&err)
+	return m.setArtwork(ctx, "poster", movie.ID, movie.PosterKey, movie.Poster)
+}
+
+// SetBackdrop stores the backdrop key and URLs of the movie, like SetPoster.
+func (m *MovieModel) SetBackdrop(ctx context.Context, movie *Movie) (err error) {
+	ctx, endSpan := startSpan(ctx, "MovieModel.SetBackdrop")
+	defer endSpan(&err)
+	return m.setArtwork(ctx, "backdrop", movie.ID, movie.BackdropKey, movie.Backdrop)
+}
+
+// setArtwork stores key and artwork in the named artwork columns of a movie.
+func (m *MovieModel) setArtwork(ctx context.Context, column string, id int64, key string, artwork Artwork) error {
+	query := fmt.Sprintf(`UPDATE movies SET %[1]s_key=NULLIF($1, ''),%[1]s=$2 WHERE id=$3 AND deleted_at IS NULL`, column)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, key, artwork, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
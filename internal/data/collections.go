@@ -0,0 +1,301 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"greenlight.darkhanomirbay/internal/validator"
+	"time"
+)
+
+var (
+	ErrUnknownMovie             = errors.New("unknown movie")
+	ErrMovieInAnotherCollection = errors.New("movie belongs to another collection")
+	ErrTrashedMovie             = errors.New("movie is in the trash")
+)
+
+// MovieCollection is the collection a movie belongs to, as shown on the movie.
+type MovieCollection struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Position int32  `json:"position"`
+}
+
+// Collection is an ordered group of movies, such as a franchise or the parts of a
+// series. MovieIDs lists its movies in order and leaves out those in the trash.
+type Collection struct {
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"-"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	MovieIDs    []int64   `json:"movie_ids"`
+	Version     int32     `json:"version,omitempty"`
+}
+
+// HideEditorFields clears the fields that only editors need, before the collection is
+// shown to an anonymous user.
+func (collection *Collection) HideEditorFields() {
+	collection.Version = 0
+}
+
+func ValidateCollection(v *validator.Validator, collection *Collection) {
+	v.Check(collection.Name != "", "name", "must be provided")
+	v.Check(len(collection.Name) <= 500, "name", "must not be more than 500 bytes long")
+	v.Check(len(collection.Description) <= 5000, "description", "must not be more than 5000 bytes long")
+
+	v.Check(len(collection.MovieIDs) <= 500, "movie_ids", "must not contain more than 500 movies")
+	v.Check(validator.Unique(collection.MovieIDs), "movie_ids", "must not contain duplicate values")
+	for _, id := range collection.MovieIDs {
+		v.Check(id > 0, "movie_ids", "must only contain positive integers")
+	}
+}
+
+const collectionColumns = `id, created_at, name, description, ARRAY(
+	SELECT collection_movies.movie_id
+	FROM collection_movies
+	INNER JOIN movies ON movies.id = collection_movies.movie_id
+	WHERE collection_movies.collection_id = collections.id AND movies.deleted_at IS NULL
+	ORDER BY collection_movies.position
+), version`
+
+func (collection *Collection) scanFields() []any {
+	return []any{
+		&collection.ID,
+		&collection.CreatedAt,
+		&collection.Name,
+		&collection.Description,
+		pq.Array(&collection.MovieIDs),
+		&collection.Version,
+	}
+}
+
+type CollectionModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+// Insert creates the collection along with its movies.
+func (m CollectionModel) Insert(ctx context.Context, collection *Collection) (err error) {
+	query := `INSERT INTO collections (name, description) VALUES ($1, $2) RETURNING id, created_at, version`
+	ctx, endSpan := startSpan(ctx, "CollectionModel.Insert")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, collection.Name, collection.Description).Scan(&collection.ID, &collection.CreatedAt, &collection.Version)
+	if err != nil {
+		return err
+	}
+	err = setCollectionMovies(ctx, tx, collection)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m CollectionModel) Get(ctx context.Context, id int64) (_ *Collection, err error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `SELECT ` + collectionColumns + ` FROM collections WHERE id = $1`
+	ctx, endSpan := startSpan(ctx, "CollectionModel.Get")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
+	defer cancel()
+
+	var collection Collection
+	err = m.DB.QueryRowContext(ctx, query, id).Scan(collection.scanFields()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &collection, nil
+}
+
+// GetAll returns a page of the collections matching the name search.
+func (m CollectionModel) GetAll(ctx context.Context, name string, filters Filters) (_ []*Collection, _ Metadata, err error) {
+	query := fmt.Sprintf(`SELECT count(*) OVER(), `+collectionColumns+`
+	FROM collections
+	WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
+	ORDER BY %s %s,id ASC
+	LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, endSpan := startSpan(ctx, "CollectionModel.GetAll")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, name, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	collections := []*Collection{}
+	totalRecords := 0
+	for rows.Next() {
+		var collection Collection
+		err := rows.Scan(append([]any{&totalRecords}, collection.scanFields()...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		collections = append(collections, &collection)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return collections, metadata, nil
+}
+
+// GetMovies returns the movies in the collection in order, leaving out those in the
+// trash.
+func (m CollectionModel) GetMovies(ctx context.Context, id int64) (_ []*Movie, err error) {
+	query := `
+SELECT ` + movieColumns + `
+FROM movies
+INNER JOIN collection_movies ON collection_movies.movie_id = movies.id
+WHERE collection_movies.collection_id = $1 AND movies.deleted_at IS NULL
+ORDER BY collection_movies.position`
+	ctx, endSpan := startSpan(ctx, "CollectionModel.GetMovies")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movies := []*Movie{}
+	for rows.Next() {
+		var movie Movie
+		err := rows.Scan(movie.scanFields()...)
+		if err != nil {
+			return nil, err
+		}
+		movies = append(movies, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return movies, nil
+}
+
+// Update saves the collection if its version still matches the stored one. With
+// setMovies its movies are replaced by MovieIDs, so movies in the trash that aren't
+// listed leave the collection; without it they are left as they are.
+func (m CollectionModel) Update(ctx context.Context, collection *Collection, setMovies bool) (err error) {
+	query := `
+UPDATE collections SET name=$1, description=$2, version=version+1
+WHERE id=$3 AND version=$4
+RETURNING version`
+	ctx, endSpan := startSpan(ctx, "CollectionModel.Update")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, collection.Name, collection.Description, collection.ID, collection.Version).Scan(&collection.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	if setMovies {
+		err = setCollectionMovies(ctx, tx, collection)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Delete removes the collection. Its movies are kept.
+func (m CollectionModel) Delete(ctx context.Context, id int64) (err error) {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `DELETE FROM collections WHERE id=$1`
+	ctx, endSpan := startSpan(ctx, "CollectionModel.Delete")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// setCollectionMovies replaces the movies of the collection with MovieIDs, numbering
+// their positions from 1. Movies in the trash may stay in the collection, but can't be
+// added to it.
+func setCollectionMovies(ctx context.Context, tx *sql.Tx, collection *Collection) error {
+	query := `
+SELECT EXISTS (
+	SELECT 1 FROM movies
+	WHERE id = ANY($2::bigint[]) AND deleted_at IS NOT NULL
+	AND NOT EXISTS (
+		SELECT 1 FROM collection_movies
+		WHERE collection_movies.collection_id = $1 AND collection_movies.movie_id = movies.id))`
+	var trashed bool
+	err := tx.QueryRowContext(ctx, query, collection.ID, pq.Array(collection.MovieIDs)).Scan(&trashed)
+	if err != nil {
+		return err
+	}
+	if trashed {
+		return ErrTrashedMovie
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM collection_movies WHERE collection_id=$1`, collection.ID)
+	if err != nil {
+		return err
+	}
+	query = `
+INSERT INTO collection_movies (collection_id, movie_id, position)
+SELECT $1, movie_id, position
+FROM unnest($2::bigint[]) WITH ORDINALITY AS listed(movie_id, position)`
+	_, err = tx.ExecContext(ctx, query, collection.ID, pq.Array(collection.MovieIDs))
+	if err != nil {
+		var pqErr *pq.Error
+		switch {
+		case errors.As(err, &pqErr) && pqErr.Code == "23503":
+			return ErrUnknownMovie
+		case errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "collection_movies_movie_id_key":
+			return ErrMovieInAnotherCollection
+		default:
+			return err
+		}
+	}
+	return nil
+}
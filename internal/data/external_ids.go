@@ -0,0 +1,123 @@
+package data
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"github.com/lib/pq"
+	"greenlight.darkhanomirbay/internal/validator"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var ErrDuplicateExternalID = errors.New("duplicate external id")
+
+// ExternalIDSources lists the catalogues a movie can be linked to, and the pattern the
+// identifiers of each must match.
+var ExternalIDSources = map[string]*regexp.Regexp{
+	"imdb":     regexp.MustCompile(`^tt\d{7,}$`),
+	"tmdb":     regexp.MustCompile(`^\d+$`),
+	"wikidata": regexp.MustCompile(`^Q\d+$`),
+}
+
+// ExternalIDs maps an external catalogue, such as "imdb", to the movie's identifier in
+// it.
+type ExternalIDs map[string]string
+
+func (e *ExternalIDs) Scan(src any) error {
+	switch src := src.(type) {
+	case nil:
+		*e = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(src, e)
+	case string:
+		return json.Unmarshal([]byte(src), e)
+	default:
+		return errors.New("unsupported external ids value")
+	}
+}
+func (e ExternalIDs) Value() (driver.Value, error) {
+	if e == nil {
+		return "{}", nil
+	}
+	js, err := json.Marshal(e)
+	return string(js), err
+}
+
+func ValidateExternalIDs(v *validator.Validator, ids ExternalIDs) {
+	for source, id := range ids {
+		rx, ok := ExternalIDSources[source]
+		if !ok {
+			v.AddError("external_ids", "must only contain imdb, tmdb or wikidata identifiers")
+			continue
+		}
+		v.Check(validator.Matches(id, rx), "external_ids."+source, "must be a valid "+source+" identifier")
+	}
+}
+
+// externalIDError translates a violation of one of the unique external id indexes into
+// ErrDuplicateExternalID and returns any other error unchanged.
+func externalIDError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && strings.HasPrefix(pqErr.Constraint, "movies_external_ids_") {
+		return ErrDuplicateExternalID
+	}
+	return err
+}
+
+var leadingArticleRX = regexp.MustCompile(`^(the|a|an)\s+`)
+
+// NormalizeTitle reduces a title to a key for duplicate detection by lower casing it,
+// dropping a leading article and removing everything but letters and digits. It must
+// be kept in step with the movie_title_key() SQL function.
+func NormalizeTitle(title string) string {
+	title = leadingArticleRX.ReplaceAllString(strings.ToLower(title), "")
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, title)
+}
+
+// FindDuplicates returns the movies that are likely to be the same film as movie: those
+// with the same normalized title, a release year at most one year apart and a runtime
+// within 10% (at least 5 minutes) of each other.
+func (m *MovieModel) FindDuplicates(ctx context.Context, movie *Movie) (_ []*Movie, err error) {
+	query := `SELECT ` + movieColumns + `
+FROM movies
+WHERE movie_title_key(title) = $1
+AND abs(year - $2) <= 1
+AND abs(runtime - $3) <= greatest(5, $3 / 10)
+AND deleted_at IS NULL
+AND id <> $4
+ORDER BY id
+LIMIT 10`
+	ctx, endSpan := startSpan(ctx, "MovieModel.FindDuplicates")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, NormalizeTitle(movie.Title), movie.Year, movie.Runtime, movie.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	duplicates := []*Movie{}
+	for rows.Next() {
+		var duplicate Movie
+		err := rows.Scan(duplicate.scanFields()...)
+		if err != nil {
+			return nil, err
+		}
+		duplicates = append(duplicates, &duplicate)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return duplicates, nil
+}
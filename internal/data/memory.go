@@ -0,0 +1,209 @@
+package data
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// memoryStore holds the records of the in-memory repositories. They share one lock, so
+// that work spanning several kinds of record, such as merging movies, is atomic like a
+// transaction would be.
+type memoryStore struct {
+	mu sync.RWMutex
+
+	movies       map[int64]*Movie
+	nextMovieID  int64
+	revisions    map[int64][]*MovieRevision
+	redirects    map[int64]int64
+	translations map[int64]map[string]*MovieTranslation
+
+	collections      map[int64]*memoryCollection
+	nextCollectionID int64
+
+	stats *MovieStats
+
+	users       map[int64]*User
+	nextUserID  int64
+	tokens      map[string]*Token
+	permissions map[int64]Permissions
+}
+
+// memoryCollection is a stored collection. Unlike Collection.MovieIDs, its movies
+// include those in the trash, each at the position it was given.
+type memoryCollection struct {
+	Collection
+	movies []collectionMovie
+}
+
+type collectionMovie struct {
+	movieID  int64
+	position int32
+}
+
+// knownPermissions are the permission codes the migrations create.
+var knownPermissions = Permissions{"movies:read", "movies:write", "movies:purge"}
+
+// NewMemoryModels returns repositories that keep everything in memory, for demos and
+// tests that shouldn't need PostgreSQL. They are safe for concurrent use and behave like
+// the PostgreSQL ones, down to optimistic locking and token expiry, but their title
+// search only matches whole words rather than using text search dictionaries.
+func NewMemoryModels() Models {
+	store := &memoryStore{
+		movies:       make(map[int64]*Movie),
+		revisions:    make(map[int64][]*MovieRevision),
+		redirects:    make(map[int64]int64),
+		translations: make(map[int64]map[string]*MovieTranslation),
+		collections:  make(map[int64]*memoryCollection),
+		users:        make(map[int64]*User),
+		tokens:       make(map[string]*Token),
+		permissions:  make(map[int64]Permissions),
+	}
+	// Like the materialized view, the statistics start out computed over no movies.
+	store.stats = store.computeStats()
+
+	return Models{
+		Movies:       &memoryMovieModel{store},
+		Revisions:    memoryMovieRevisionModel{store},
+		Users:        memoryUserModel{store},
+		Tokens:       memoryTokenModel{store},
+		Permissions:  memoryPermissionModel{store},
+		Stats:        memoryStatsModel{store},
+		Collections:  memoryCollectionModel{store},
+		Translations: memoryMovieTranslationModel{store},
+	}
+}
+
+// cloneMovie returns a deep copy of movie, so that callers never share a stored record.
+func cloneMovie(movie *Movie) *Movie {
+	clone := *movie
+	if movie.DeletedAt != nil {
+		deletedAt := *movie.DeletedAt
+		clone.DeletedAt = &deletedAt
+	}
+	if movie.Genres != nil {
+		clone.Genres = append([]string{}, movie.Genres...)
+	}
+	clone.Poster = cloneMap(movie.Poster)
+	clone.Backdrop = cloneMap(movie.Backdrop)
+	clone.ExternalIDs = cloneMap(movie.ExternalIDs)
+	clone.ReleaseDates = cloneMap(movie.ReleaseDates)
+	clone.Certifications = cloneMap(movie.Certifications)
+	if movie.Collection != nil {
+		collection := *movie.Collection
+		clone.Collection = &collection
+	}
+	return &clone
+}
+
+func cloneMap[M ~map[string]string](m M) M {
+	if m == nil {
+		return nil
+	}
+	clone := make(M, len(m))
+	for key, value := range m {
+		clone[key] = value
+	}
+	return clone
+}
+
+// containsAll reports whether every entry of want is also in have.
+func containsAll[M ~map[string]string](have, want M) bool {
+	for key, value := range want {
+		if v, ok := have[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// titleTokens returns the lower cased words of a title. It must be kept in step with
+// the title_tokens() SQL function.
+func titleTokens(title string) []string {
+	return strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// matchesSearch reports whether text contains every word of search, which is how the
+// repositories match a plainto_tsquery against a text without a dictionary. An empty
+// search matches everything.
+func matchesSearch(text, search string) bool {
+	words := make(map[string]bool)
+	for _, word := range titleTokens(text) {
+		words[word] = true
+	}
+	for _, word := range titleTokens(search) {
+		if !words[word] {
+			return false
+		}
+	}
+	return true
+}
+
+// jaccard returns the Jaccard similarity of a and b treated as sets, like the
+// array_jaccard() SQL function.
+func jaccard(a, b []string) float64 {
+	setA, setB := make(map[string]bool), make(map[string]bool)
+	for _, value := range a {
+		setA[value] = true
+	}
+	for _, value := range b {
+		setB[value] = true
+	}
+	intersection := 0
+	for value := range setB {
+		if setA[value] {
+			intersection++
+		}
+	}
+	union := len(setA) + len(setB) - intersection
+	if union == 0 {
+		return 0
+	}
+	return float64(intersection) / float64(union)
+}
+
+// sortRecords orders records by the column and direction in filters, breaking ties by
+// id in ascending order like the queries of the PostgreSQL repositories.
+func sortRecords[T any](records []T, filters Filters, less func(a, b T, column string) bool, id func(T) int64) {
+	column, descending := filters.sortColumn(), filters.sortDirection() == "DESC"
+	sort.SliceStable(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		switch {
+		case less(a, b, column):
+			return !descending
+		case less(b, a, column):
+			return descending
+		default:
+			return id(a) < id(b)
+		}
+	})
+}
+
+// paginate returns the page of records that filters selects, with its metadata. Like
+// the count(*) OVER() queries, pages past the end come back empty and without metadata.
+func paginate[T any](records []T, filters Filters) ([]T, Metadata) {
+	offset := filters.offset()
+	if offset >= len(records) {
+		return []T{}, Metadata{}
+	}
+	end := offset + filters.limit()
+	if end > len(records) {
+		end = len(records)
+	}
+	return records[offset:end], calculateMetadata(len(records), filters.Page, filters.PageSize)
+}
+
+func lessTime(a, b *time.Time) bool {
+	switch {
+	case a == nil:
+		return b != nil
+	case b == nil:
+		return false
+	default:
+		return a.Before(*b)
+	}
+}
@@ -0,0 +1,174 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+type memoryCollectionModel struct {
+	store *memoryStore
+}
+
+func lessCollection(a, b *memoryCollection, column string) bool {
+	if column == "name" {
+		return a.Name < b.Name
+	}
+	return a.ID < b.ID
+}
+
+func collectionID(collection *memoryCollection) int64 {
+	return collection.ID
+}
+
+// readCollection returns a copy of the stored collection, listing the movies that
+// aren't in the trash. The caller must hold the lock.
+func (s *memoryStore) readCollection(collection *memoryCollection) *Collection {
+	clone := collection.Collection
+	clone.MovieIDs = []int64{}
+	for _, entry := range collection.movies {
+		if _, ok := s.liveMovie(entry.movieID); ok {
+			clone.MovieIDs = append(clone.MovieIDs, entry.movieID)
+		}
+	}
+	return &clone
+}
+
+// removeMovie takes the movie out of the collection, leaving the positions of the
+// others as they were.
+func (c *memoryCollection) removeMovie(movieID int64) {
+	movies := c.movies[:0]
+	for _, entry := range c.movies {
+		if entry.movieID != movieID {
+			movies = append(movies, entry)
+		}
+	}
+	c.movies = movies
+}
+
+// checkCollectionMovies stands in for the foreign key and unique constraints on the
+// movies of a collection, and rejects movies in the trash that aren't members yet. The
+// caller must hold the lock.
+func (s *memoryStore) checkCollectionMovies(collection *Collection) error {
+	for _, id := range collection.MovieIDs {
+		movie, ok := s.movies[id]
+		if !ok {
+			return ErrUnknownMovie
+		}
+		other := s.movieCollection(id)
+		if other != nil && other.ID != collection.ID {
+			return ErrMovieInAnotherCollection
+		}
+		if movie.DeletedAt != nil && other == nil {
+			return ErrTrashedMovie
+		}
+	}
+	return nil
+}
+
+func collectionMovies(ids []int64) []collectionMovie {
+	movies := make([]collectionMovie, len(ids))
+	for i, id := range ids {
+		movies[i] = collectionMovie{movieID: id, position: int32(i + 1)}
+	}
+	return movies
+}
+
+func (m memoryCollectionModel) Insert(ctx context.Context, collection *Collection) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	err := m.store.checkCollectionMovies(collection)
+	if err != nil {
+		return err
+	}
+	m.store.nextCollectionID++
+	collection.ID = m.store.nextCollectionID
+	collection.CreatedAt = time.Now()
+	collection.Version = 1
+
+	stored := &memoryCollection{Collection: *collection, movies: collectionMovies(collection.MovieIDs)}
+	stored.MovieIDs = nil
+	m.store.collections[collection.ID] = stored
+	return nil
+}
+
+func (m memoryCollectionModel) Get(ctx context.Context, id int64) (*Collection, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	collection, ok := m.store.collections[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return m.store.readCollection(collection), nil
+}
+
+func (m memoryCollectionModel) GetAll(ctx context.Context, name string, filters Filters) ([]*Collection, Metadata, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	matches := []*memoryCollection{}
+	for _, collection := range m.store.collections {
+		if matchesSearch(collection.Name, name) {
+			matches = append(matches, collection)
+		}
+	}
+	sortRecords(matches, filters, lessCollection, collectionID)
+	page, metadata := paginate(matches, filters)
+
+	collections := make([]*Collection, len(page))
+	for i, collection := range page {
+		collections[i] = m.store.readCollection(collection)
+	}
+	return collections, metadata, nil
+}
+
+func (m memoryCollectionModel) GetMovies(ctx context.Context, id int64) ([]*Movie, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	movies := []*Movie{}
+	collection, ok := m.store.collections[id]
+	if !ok {
+		return movies, nil
+	}
+	for _, entry := range collection.movies {
+		if movie, ok := m.store.liveMovie(entry.movieID); ok {
+			movies = append(movies, m.store.readMovie(movie))
+		}
+	}
+	return movies, nil
+}
+
+func (m memoryCollectionModel) Update(ctx context.Context, collection *Collection, setMovies bool) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	stored, ok := m.store.collections[collection.ID]
+	if !ok || stored.Version != collection.Version {
+		return ErrEditConflict
+	}
+	if setMovies {
+		err := m.store.checkCollectionMovies(collection)
+		if err != nil {
+			return err
+		}
+		stored.movies = collectionMovies(collection.MovieIDs)
+	}
+	stored.Name = collection.Name
+	stored.Description = collection.Description
+	stored.Version++
+	collection.Version = stored.Version
+	return nil
+}
+
+func (m memoryCollectionModel) Delete(ctx context.Context, id int64) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if _, ok := m.store.collections[id]; !ok {
+		return ErrRecordNotFound
+	}
+	delete(m.store.collections, id)
+	return nil
+}
@@ -0,0 +1,654 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+type memoryMovieModel struct {
+	store *memoryStore
+}
+
+func lessMovie(a, b *Movie, column string) bool {
+	switch column {
+	case "title":
+		return a.Title < b.Title
+	case "year":
+		return a.Year < b.Year
+	case "runtime":
+		return a.Runtime < b.Runtime
+	case "deleted_at":
+		return lessTime(a.DeletedAt, b.DeletedAt)
+	default:
+		return a.ID < b.ID
+	}
+}
+
+func movieID(movie *Movie) int64 {
+	return movie.ID
+}
+
+// liveMovie returns the stored movie with the given id unless it is missing or in the
+// trash. The caller must hold the lock.
+func (s *memoryStore) liveMovie(id int64) (*Movie, bool) {
+	movie, ok := s.movies[id]
+	if !ok || movie.DeletedAt != nil {
+		return nil, false
+	}
+	return movie, true
+}
+
+// readMovie returns a copy of the stored movie with its collection filled in, as the
+// PostgreSQL repository would read it. The caller must hold the lock.
+func (s *memoryStore) readMovie(movie *Movie) *Movie {
+	clone := cloneMovie(movie)
+	clone.Collection = s.movieCollection(movie.ID)
+	return clone
+}
+
+// movieCollection mirrors the movie_collection() SQL function.
+func (s *memoryStore) movieCollection(movieID int64) *MovieCollection {
+	for _, collection := range s.collections {
+		for _, entry := range collection.movies {
+			if entry.movieID == movieID {
+				return &MovieCollection{ID: collection.ID, Name: collection.Name, Position: entry.position}
+			}
+		}
+	}
+	return nil
+}
+
+// checkExternalIDs stands in for the unique indexes on external ids, which cover the
+// movies in the trash too. Movies with the ids in ignore are skipped.
+func (s *memoryStore) checkExternalIDs(movie *Movie, ignore ...int64) error {
+	for _, other := range s.movies {
+		skip := other.ID == movie.ID
+		for _, id := range ignore {
+			skip = skip || other.ID == id
+		}
+		if skip {
+			continue
+		}
+		for source, id := range movie.ExternalIDs {
+			if other.ExternalIDs[source] == id {
+				return ErrDuplicateExternalID
+			}
+		}
+	}
+	return nil
+}
+
+// addRevision records the current version of the movie. The caller must hold the lock.
+func (s *memoryStore) addRevision(movie *Movie, userID *int64, createdAt time.Time) {
+	for _, revision := range s.revisions[movie.ID] {
+		if revision.Version == movie.Version {
+			return
+		}
+	}
+	s.revisions[movie.ID] = append(s.revisions[movie.ID], &MovieRevision{
+		MovieID:          movie.ID,
+		Version:          movie.Version,
+		Title:            movie.Title,
+		Year:             movie.Year,
+		Runtime:          movie.Runtime,
+		Genres:           append([]string{}, movie.Genres...),
+		Tagline:          movie.Tagline,
+		Synopsis:         movie.Synopsis,
+		OriginalLanguage: movie.OriginalLanguage,
+		ExternalIDs:      cloneMap(movie.ExternalIDs),
+		ReleaseDates:     cloneMap(movie.ReleaseDates),
+		Certifications:   cloneMap(movie.Certifications),
+		UserID:           userID,
+		CreatedAt:        createdAt,
+	})
+}
+
+// updateMovie does the work of MovieModel.updateTx. The caller must hold the lock.
+func (s *memoryStore) updateMovie(movie *Movie, editorID int64, ignore ...int64) error {
+	stored, ok := s.liveMovie(movie.ID)
+	if !ok || stored.Version != movie.Version {
+		return ErrEditConflict
+	}
+	err := s.checkExternalIDs(movie, ignore...)
+	if err != nil {
+		return err
+	}
+	s.addRevision(stored, nil, stored.CreatedAt)
+
+	update := cloneMovie(movie)
+	stored.Title = update.Title
+	stored.Year = update.Year
+	stored.Runtime = update.Runtime
+	stored.Genres = update.Genres
+	stored.ExternalIDs = update.ExternalIDs
+	stored.Tagline = update.Tagline
+	stored.Synopsis = update.Synopsis
+	stored.OriginalLanguage = update.OriginalLanguage
+	stored.ReleaseDates = update.ReleaseDates
+	stored.Certifications = update.Certifications
+	stored.Version++
+
+	movie.Version = stored.Version
+	s.addRevision(stored, &editorID, time.Now())
+	return nil
+}
+
+// deleteMovie removes the movie and everything that cascades from it. The caller must
+// hold the lock.
+func (s *memoryStore) deleteMovie(id int64) {
+	delete(s.movies, id)
+	delete(s.revisions, id)
+	delete(s.translations, id)
+	for oldID, newID := range s.redirects {
+		if newID == id {
+			delete(s.redirects, oldID)
+		}
+	}
+	for _, collection := range s.collections {
+		collection.removeMovie(id)
+	}
+}
+
+func (m *memoryMovieModel) Insert(ctx context.Context, movie *Movie, editorID int64) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	err := m.store.checkExternalIDs(movie)
+	if err != nil {
+		return err
+	}
+	m.store.nextMovieID++
+	movie.ID = m.store.nextMovieID
+	movie.CreatedAt = time.Now()
+	movie.Version = 1
+
+	stored := cloneMovie(movie)
+	stored.DeletedAt, stored.Collection = nil, nil
+	stored.PosterKey, stored.Poster, stored.BackdropKey, stored.Backdrop = "", nil, "", nil
+	m.store.movies[movie.ID] = stored
+	m.store.addRevision(stored, &editorID, movie.CreatedAt)
+	return nil
+}
+
+func (m *memoryMovieModel) Get(ctx context.Context, id int64) (*Movie, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	movie, ok := m.store.liveMovie(id)
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return m.store.readMovie(movie), nil
+}
+
+func (m *memoryMovieModel) Update(ctx context.Context, movie *Movie, editorID int64) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	return m.store.updateMovie(movie, editorID)
+}
+
+func (m *memoryMovieModel) Delete(ctx context.Context, id int64) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	movie, ok := m.store.liveMovie(id)
+	if !ok {
+		return ErrRecordNotFound
+	}
+	now := time.Now()
+	movie.DeletedAt = &now
+	return nil
+}
+
+func (m *memoryMovieModel) Restore(ctx context.Context, id int64) (*Movie, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	movie, ok := m.store.movies[id]
+	if !ok || movie.DeletedAt == nil {
+		return nil, ErrRecordNotFound
+	}
+	movie.DeletedAt = nil
+	return m.store.readMovie(movie), nil
+}
+
+func (m *memoryMovieModel) Purge(ctx context.Context, id int64) (PurgedMovie, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	movie, ok := m.store.movies[id]
+	if !ok || movie.DeletedAt == nil {
+		return PurgedMovie{}, ErrRecordNotFound
+	}
+	m.store.deleteMovie(id)
+	return purgedMovie(movie), nil
+}
+
+// purgedMovie returns the stored objects of a movie that has been purged.
+func purgedMovie(movie *Movie) PurgedMovie {
+	return PurgedMovie{
+		ID:          movie.ID,
+		PosterKey:   movie.PosterKey,
+		Poster:      cloneMap(movie.Poster),
+		BackdropKey: movie.BackdropKey,
+		Backdrop:    cloneMap(movie.Backdrop),
+	}
+}
+
+func (m *memoryMovieModel) PurgeTrashed(ctx context.Context, cutoff time.Time) ([]PurgedMovie, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	purged := []PurgedMovie{}
+	for id, movie := range m.store.movies {
+		if movie.DeletedAt != nil && movie.DeletedAt.Before(cutoff) {
+			m.store.deleteMovie(id)
+			purged = append(purged, purgedMovie(movie))
+		}
+	}
+	return purged, nil
+}
+
+func (m *memoryMovieModel) GetAllTrashed(ctx context.Context, filters Filters) ([]*Movie, Metadata, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	movies := []*Movie{}
+	for _, movie := range m.store.movies {
+		if movie.DeletedAt != nil {
+			movies = append(movies, movie)
+		}
+	}
+	sortRecords(movies, filters, lessMovie, movieID)
+	page, metadata := paginate(movies, filters)
+	return m.readMovies(page), metadata, nil
+}
+
+func (m *memoryMovieModel) GetAll(ctx context.Context, title string, genres []string, externalIDs ExternalIDs, originalLanguage string, certifications Certifications, filters Filters) ([]*Movie, Metadata, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	movies := []*Movie{}
+	for _, movie := range m.store.movies {
+		if m.store.matchesMovieSearch(movie, title, genres, externalIDs, originalLanguage, certifications) {
+			movies = append(movies, movie)
+		}
+	}
+	sortRecords(movies, filters, lessMovie, movieID)
+	page, metadata := paginate(movies, filters)
+	return m.readMovies(page), metadata, nil
+}
+
+// matchesMovieSearch reports whether the movie is live and matches the search filters
+// of GetAll and Export. The caller must hold the lock.
+func (s *memoryStore) matchesMovieSearch(movie *Movie, title string, genres []string, externalIDs ExternalIDs, originalLanguage string, certifications Certifications) bool {
+	if movie.DeletedAt != nil || !s.matchesTitle(movie, title) || len(difference(genres, movie.Genres)) > 0 {
+		return false
+	}
+	if !containsAll(movie.ExternalIDs, externalIDs) || !containsAll(movie.Certifications, certifications) {
+		return false
+	}
+	return originalLanguage == "" || movie.OriginalLanguage == originalLanguage
+}
+
+// matchesTitle reports whether the title search matches the movie or one of its
+// translations. The caller must hold the lock.
+func (s *memoryStore) matchesTitle(movie *Movie, title string) bool {
+	if matchesSearch(movie.Title, title) {
+		return true
+	}
+	for _, translation := range s.translations[movie.ID] {
+		if matchesSearch(translation.Title, title) {
+			return true
+		}
+	}
+	return false
+}
+
+// readMovies returns copies of the stored movies. The caller must hold the lock.
+func (m *memoryMovieModel) readMovies(stored []*Movie) []*Movie {
+	movies := make([]*Movie, len(stored))
+	for i, movie := range stored {
+		movies[i] = m.store.readMovie(movie)
+	}
+	return movies
+}
+
+// Export reads the movies under the lock, like the snapshot the PostgreSQL export
+// reads from, and passes them to fn once it is released.
+func (m *memoryMovieModel) Export(ctx context.Context, title string, genres []string, externalIDs ExternalIDs, originalLanguage string, certifications Certifications, batchSize int, fn func(*Movie) error) error {
+	m.store.mu.RLock()
+	movies := []*Movie{}
+	for _, movie := range m.store.movies {
+		if m.store.matchesMovieSearch(movie, title, genres, externalIDs, originalLanguage, certifications) {
+			movies = append(movies, m.store.readMovie(movie))
+		}
+	}
+	m.store.mu.RUnlock()
+
+	sort.Slice(movies, func(i, j int) bool { return movies[i].ID < movies[j].ID })
+	for i, movie := range movies {
+		if i%batchSize == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		err := fn(movie)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memoryMovieModel) BeginImport(ctx context.Context, savepoints bool, editorID int64) (MovieImporter, error) {
+	return &memoryMovieImport{store: m.store, savepoints: savepoints, editorID: editorID}, nil
+}
+
+func (m *memoryMovieModel) FindDuplicates(ctx context.Context, movie *Movie) ([]*Movie, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	key := NormalizeTitle(movie.Title)
+	tolerance := movie.Runtime / 10
+	if tolerance < 5 {
+		tolerance = 5
+	}
+	duplicates := []*Movie{}
+	for _, other := range m.store.movies {
+		if other.DeletedAt != nil || other.ID == movie.ID || NormalizeTitle(other.Title) != key {
+			continue
+		}
+		if abs(other.Year-movie.Year) <= 1 && abs(other.Runtime-movie.Runtime) <= tolerance {
+			duplicates = append(duplicates, other)
+		}
+	}
+	sort.Slice(duplicates, func(i, j int) bool { return duplicates[i].ID < duplicates[j].ID })
+	if len(duplicates) > 10 {
+		duplicates = duplicates[:10]
+	}
+	return m.readMovies(duplicates), nil
+}
+
+func abs[T int32 | Runtime](n T) T {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// Merge follows MovieModel.Merge. Everything that can fail is checked before anything
+// is changed, so a failed merge leaves the store as it was.
+func (m *memoryMovieModel) Merge(ctx context.Context, target, source *Movie, editorID int64) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	storedSource, ok := m.store.liveMovie(source.ID)
+	if !ok || storedSource.Version != source.Version {
+		return ErrEditConflict
+	}
+	if storedTarget, ok := m.store.liveMovie(target.ID); !ok || storedTarget.Version != target.Version {
+		return ErrEditConflict
+	}
+	// The source gives up its external ids, so they don't count as duplicates.
+	err := m.store.checkExternalIDs(target, source.ID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	storedSource.DeletedAt = &now
+	storedSource.ExternalIDs = ExternalIDs{}
+	storedSource.PosterKey, storedSource.Poster = "", nil
+	storedSource.BackdropKey, storedSource.Backdrop = "", nil
+
+	if m.store.movieCollection(target.ID) == nil {
+		for _, collection := range m.store.collections {
+			for i := range collection.movies {
+				if collection.movies[i].movieID == source.ID {
+					collection.movies[i].movieID = target.ID
+				}
+			}
+		}
+	}
+	for _, collection := range m.store.collections {
+		collection.removeMovie(source.ID)
+	}
+
+	for locale, translation := range m.store.translations[source.ID] {
+		if _, ok := m.store.translations[target.ID][locale]; ok {
+			continue
+		}
+		if m.store.translations[target.ID] == nil {
+			m.store.translations[target.ID] = make(map[string]*MovieTranslation)
+		}
+		translation.MovieID = target.ID
+		m.store.translations[target.ID][locale] = translation
+		delete(m.store.translations[source.ID], locale)
+	}
+
+	err = m.store.updateMovie(target, editorID)
+	if err != nil {
+		return err
+	}
+	storedTarget := m.store.movies[target.ID]
+	storedTarget.PosterKey, storedTarget.Poster = target.PosterKey, cloneMap(target.Poster)
+	storedTarget.BackdropKey, storedTarget.Backdrop = target.BackdropKey, cloneMap(target.Backdrop)
+
+	for oldID, newID := range m.store.redirects {
+		if newID == source.ID {
+			m.store.redirects[oldID] = target.ID
+		}
+	}
+	m.store.redirects[source.ID] = target.ID
+	return nil
+}
+
+func (m *memoryMovieModel) GetRedirect(ctx context.Context, id int64) (int64, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	newID, ok := m.store.redirects[id]
+	if !ok {
+		return 0, ErrRecordNotFound
+	}
+	if _, ok := m.store.liveMovie(newID); !ok {
+		return 0, ErrRecordNotFound
+	}
+	return newID, nil
+}
+
+func (m *memoryMovieModel) SetPoster(ctx context.Context, movie *Movie) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	stored, ok := m.store.liveMovie(movie.ID)
+	if !ok {
+		return ErrRecordNotFound
+	}
+	stored.PosterKey, stored.Poster = movie.PosterKey, cloneMap(movie.Poster)
+	if len(stored.Poster) == 0 {
+		stored.Poster = nil
+	}
+	return nil
+}
+
+func (m *memoryMovieModel) SetBackdrop(ctx context.Context, movie *Movie) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	stored, ok := m.store.liveMovie(movie.ID)
+	if !ok {
+		return ErrRecordNotFound
+	}
+	stored.BackdropKey, stored.Backdrop = movie.BackdropKey, cloneMap(movie.Backdrop)
+	if len(stored.Backdrop) == 0 {
+		stored.Backdrop = nil
+	}
+	return nil
+}
+
+// GetSimilar scores the movies the way the SQL query of MovieModel.GetSimilar does.
+func (m *memoryMovieModel) GetSimilar(ctx context.Context, movie *Movie, filters Filters) ([]*SimilarMovie, Metadata, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	tokens := titleTokens(movie.Title)
+	candidates := []*SimilarMovie{}
+	for _, other := range m.store.movies {
+		if other.DeletedAt != nil || other.ID == movie.ID || len(difference(other.Genres, movie.Genres)) == len(other.Genres) {
+			continue
+		}
+		similarity := similarityGenreWeight*jaccard(other.Genres, movie.Genres) +
+			similarityYearWeight/(1+float64(abs(other.Year-movie.Year))/5.0) +
+			similarityRuntimeWeight/(1+float64(abs(other.Runtime-movie.Runtime))/15.0) +
+			similarityTitleWeight*jaccard(titleTokens(other.Title), tokens)
+		candidates = append(candidates, &SimilarMovie{Movie: other, Similarity: similarity})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Similarity != candidates[j].Similarity {
+			return candidates[i].Similarity > candidates[j].Similarity
+		}
+		return candidates[i].ID < candidates[j].ID
+	})
+	page, metadata := paginate(candidates, filters)
+	for i, similar := range page {
+		page[i] = &SimilarMovie{Movie: m.store.readMovie(similar.Movie), Similarity: similar.Similarity}
+	}
+	return page, metadata, nil
+}
+
+// memoryMovieImport stages the copied movies and adds them to the store on commit. A
+// rejected batch aborts the import unless savepoints is set, as it would abort the
+// PostgreSQL transaction.
+type memoryMovieImport struct {
+	store      *memoryStore
+	savepoints bool
+	editorID   int64
+	staged     []*Movie
+	aborted    bool
+	done       bool
+}
+
+var errImportAborted = errors.New("import aborted by a rejected batch")
+
+func (i *memoryMovieImport) CopyBatch(ctx context.Context, movies []*Movie) error {
+	switch {
+	case i.done:
+		return sql.ErrTxDone
+	case i.aborted:
+		return errImportAborted
+	}
+
+	i.store.mu.RLock()
+	defer i.store.mu.RUnlock()
+
+	// Check the rows as the database would, one after the other, so that a row clashing
+	// with an earlier row of the same batch is the one rejected.
+	staged := i.staged
+	rejected := make(map[int]string)
+	for n, movie := range movies {
+		err := i.checkRow(movie, staged)
+		if err != nil {
+			rejected[n] = err.Error()
+			continue
+		}
+		staged = append(staged, &Movie{
+			Title:            movie.Title,
+			Year:             movie.Year,
+			Runtime:          movie.Runtime,
+			Genres:           append([]string{}, movie.Genres...),
+			ExternalIDs:      cloneMap(movie.ExternalIDs),
+			Tagline:          movie.Tagline,
+			Synopsis:         movie.Synopsis,
+			OriginalLanguage: movie.OriginalLanguage,
+			ReleaseDates:     cloneMap(movie.ReleaseDates),
+			Certifications:   cloneMap(movie.Certifications),
+		})
+	}
+	switch {
+	case len(rejected) == 0:
+		i.staged = staged
+		return nil
+	case !i.savepoints:
+		i.aborted = true
+		for n := range movies {
+			if reason, ok := rejected[n]; ok {
+				return fmt.Errorf("%w: %s", ErrImportBatchRejected, reason)
+			}
+		}
+	}
+	i.staged = staged
+	return &ImportRowsRejectedError{Rows: rejected}
+}
+
+// checkRow stands in for the constraints and unique indexes the row would be checked
+// against by the database. The caller must hold the lock.
+func (i *memoryMovieImport) checkRow(movie *Movie, staged []*Movie) error {
+	err := checkMovieConstraints(movie)
+	if err != nil {
+		return err
+	}
+	duplicate := errors.New("a movie with one of these external ids already exists")
+	if i.store.checkExternalIDs(movie) != nil {
+		return duplicate
+	}
+	for _, other := range staged {
+		for source, id := range movie.ExternalIDs {
+			if other.ExternalIDs[source] == id {
+				return duplicate
+			}
+		}
+	}
+	return nil
+}
+
+func (i *memoryMovieImport) Commit() error {
+	switch {
+	case i.done:
+		return sql.ErrTxDone
+	case i.aborted:
+		i.done = true
+		return errImportAborted
+	}
+	i.done = true
+
+	i.store.mu.Lock()
+	defer i.store.mu.Unlock()
+	now := time.Now()
+	for _, movie := range i.staged {
+		i.store.nextMovieID++
+		movie.ID = i.store.nextMovieID
+		movie.CreatedAt = now
+		movie.Version = 1
+		i.store.movies[movie.ID] = movie
+		i.store.addRevision(movie, &i.editorID, now)
+	}
+	return nil
+}
+
+func (i *memoryMovieImport) Rollback() error {
+	if i.done {
+		return sql.ErrTxDone
+	}
+	i.done = true
+	return nil
+}
+
+// checkMovieConstraints stands in for the check constraints of the movies table.
+func checkMovieConstraints(movie *Movie) error {
+	switch {
+	case movie.Runtime < 0:
+		return errors.New(`new row for relation "movies" violates check constraint "movies_runtime_check"`)
+	case movie.Year < 1888 || movie.Year > int32(time.Now().Year()):
+		return errors.New(`new row for relation "movies" violates check constraint "movies_year_check"`)
+	case len(movie.Genres) < 1 || len(movie.Genres) > 5:
+		return errors.New(`new row for relation "movies" violates check constraint "genres_length_check"`)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package data
+
+import "context"
+
+type memoryMovieRevisionModel struct {
+	store *memoryStore
+}
+
+func (m memoryMovieRevisionModel) Get(ctx context.Context, movieID int64, version int32) (*MovieRevision, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	for _, revision := range m.store.revisions[movieID] {
+		if revision.Version == version {
+			return cloneRevision(revision), nil
+		}
+	}
+	return nil, ErrRecordNotFound
+}
+
+func (m memoryMovieRevisionModel) GetAllForMovie(ctx context.Context, movieID int64, filters Filters) ([]*MovieRevision, Metadata, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	revisions := append([]*MovieRevision{}, m.store.revisions[movieID]...)
+	sortRecords(revisions, filters, func(a, b *MovieRevision, column string) bool {
+		return a.Version < b.Version
+	}, func(revision *MovieRevision) int64 {
+		return int64(revision.Version)
+	})
+	page, metadata := paginate(revisions, filters)
+	for i, revision := range page {
+		page[i] = cloneRevision(revision)
+	}
+	return page, metadata, nil
+}
+
+func cloneRevision(revision *MovieRevision) *MovieRevision {
+	clone := *revision
+	clone.Genres = append([]string{}, revision.Genres...)
+	clone.ExternalIDs = cloneMap(revision.ExternalIDs)
+	clone.ReleaseDates = cloneMap(revision.ReleaseDates)
+	clone.Certifications = cloneMap(revision.Certifications)
+	if revision.UserID != nil {
+		userID := *revision.UserID
+		clone.UserID = &userID
+	}
+	return &clone
+}
@@ -0,0 +1,93 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+type memoryStatsModel struct {
+	store *memoryStore
+}
+
+func (m memoryStatsModel) GetMovieStats(ctx context.Context) (*MovieStats, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	stats := *m.store.stats
+	return &stats, nil
+}
+
+func (m memoryStatsModel) RefreshMovieStats(ctx context.Context) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	m.store.stats = m.store.computeStats()
+	return nil
+}
+
+// computeStats calculates what the movie_stats materialized view holds. The caller must
+// hold the lock.
+func (s *memoryStore) computeStats() *MovieStats {
+	stats := &MovieStats{
+		RefreshedAt:      time.Now(),
+		ByGenre:          []GenreCount{},
+		ByDecade:         []DecadeCount{},
+		RuntimeHistogram: []RuntimeBucket{},
+		AddedPerWeek:     []WeekCount{},
+	}
+	genres := make(map[string]int64)
+	decades := make(map[int32]*DecadeCount)
+	buckets := make(map[int32]int64)
+	weeks := make(map[string]int64)
+	var totalRuntime int64
+
+	for _, movie := range s.movies {
+		if movie.DeletedAt != nil {
+			continue
+		}
+		stats.TotalMovies++
+		totalRuntime += int64(movie.Runtime)
+		for _, genre := range movie.Genres {
+			genres[genre]++
+		}
+		decade := movie.Year / 10 * 10
+		if decades[decade] == nil {
+			decades[decade] = &DecadeCount{Decade: decade}
+		}
+		decades[decade].Count++
+		decades[decade].AverageRuntime += float64(movie.Runtime)
+		buckets[int32(movie.Runtime)/30*30]++
+
+		created := movie.CreatedAt.UTC()
+		monday := created.AddDate(0, 0, -(int(created.Weekday())+6)%7)
+		weeks[monday.Format("2006-01-02")]++
+	}
+
+	stats.TotalGenres = int64(len(genres))
+	if stats.TotalMovies > 0 {
+		stats.AverageRuntime = float64(totalRuntime) / float64(stats.TotalMovies)
+	}
+	for genre, count := range genres {
+		stats.ByGenre = append(stats.ByGenre, GenreCount{Genre: genre, Count: count})
+	}
+	sort.Slice(stats.ByGenre, func(i, j int) bool {
+		a, b := stats.ByGenre[i], stats.ByGenre[j]
+		return a.Count > b.Count || a.Count == b.Count && a.Genre < b.Genre
+	})
+	for _, decade := range decades {
+		average := decade.AverageRuntime / float64(decade.Count)
+		decade.AverageRuntime = float64(int64(average*10+0.5)) / 10
+		stats.ByDecade = append(stats.ByDecade, *decade)
+	}
+	sort.Slice(stats.ByDecade, func(i, j int) bool { return stats.ByDecade[i].Decade < stats.ByDecade[j].Decade })
+	for from, count := range buckets {
+		stats.RuntimeHistogram = append(stats.RuntimeHistogram, RuntimeBucket{From: from, To: from + 29, Count: count})
+	}
+	sort.Slice(stats.RuntimeHistogram, func(i, j int) bool { return stats.RuntimeHistogram[i].From < stats.RuntimeHistogram[j].From })
+	for week, count := range weeks {
+		stats.AddedPerWeek = append(stats.AddedPerWeek, WeekCount{Week: week, Count: count})
+	}
+	sort.Slice(stats.AddedPerWeek, func(i, j int) bool { return stats.AddedPerWeek[i].Week < stats.AddedPerWeek[j].Week })
+	return stats
+}
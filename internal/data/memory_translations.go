@@ -0,0 +1,80 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+)
+
+type memoryMovieTranslationModel struct {
+	store *memoryStore
+}
+
+func (m memoryMovieTranslationModel) Upsert(ctx context.Context, translation *MovieTranslation) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if _, ok := m.store.movies[translation.MovieID]; !ok {
+		return ErrRecordNotFound
+	}
+	if m.store.translations[translation.MovieID] == nil {
+		m.store.translations[translation.MovieID] = make(map[string]*MovieTranslation)
+	}
+	translation.UpdatedAt = time.Now()
+	stored := *translation
+	m.store.translations[translation.MovieID][translation.Locale] = &stored
+	return nil
+}
+
+func (m memoryMovieTranslationModel) GetAllForMovie(ctx context.Context, movieID int64) ([]*MovieTranslation, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	translations := []*MovieTranslation{}
+	for _, translation := range m.store.translations[movieID] {
+		clone := *translation
+		translations = append(translations, &clone)
+	}
+	sort.Slice(translations, func(i, j int) bool { return translations[i].Locale < translations[j].Locale })
+	return translations, nil
+}
+
+func (m memoryMovieTranslationModel) Delete(ctx context.Context, movieID int64, locale string) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if _, ok := m.store.translations[movieID][locale]; !ok {
+		return ErrRecordNotFound
+	}
+	delete(m.store.translations[movieID], locale)
+	return nil
+}
+
+func (m memoryMovieTranslationModel) Localize(ctx context.Context, movies []*Movie, locales []string) error {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	for _, movie := range movies {
+		var best *MovieTranslation
+		bestRank := len(locales)
+		for _, translation := range m.store.translations[movie.ID] {
+			for rank, locale := range locales[:bestRank] {
+				if strings.EqualFold(translation.Locale, locale) {
+					best, bestRank = translation, rank
+					break
+				}
+			}
+		}
+		if best == nil {
+			continue
+		}
+		movie.OriginalTitle = movie.Title
+		movie.Title = best.Title
+		movie.Locale = best.Locale
+		if best.Synopsis != "" {
+			movie.Synopsis = best.Synopsis
+		}
+	}
+	return nil
+}
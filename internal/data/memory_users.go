@@ -0,0 +1,148 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"strings"
+	"time"
+)
+
+type memoryUserModel struct {
+	store *memoryStore
+}
+
+// emailTaken stands in for the unique index on the citext email column, so addresses
+// that differ only in case clash. The caller must hold the lock.
+func (s *memoryStore) emailTaken(user *User) bool {
+	for _, other := range s.users {
+		if other.ID != user.ID && strings.EqualFold(other.Email, user.Email) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m memoryUserModel) Insert(ctx context.Context, user *User) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if m.store.emailTaken(user) {
+		return ErrDuplicateEmail
+	}
+	m.store.nextUserID++
+	user.ID = m.store.nextUserID
+	user.CreatedAt = time.Now()
+	user.Version = 1
+
+	stored := *user
+	m.store.users[user.ID] = &stored
+	return nil
+}
+
+func (m memoryUserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	for _, user := range m.store.users {
+		if strings.EqualFold(user.Email, email) {
+			clone := *user
+			return &clone, nil
+		}
+	}
+	return nil, ErrRecordNotFound
+}
+
+func (m memoryUserModel) Update(ctx context.Context, user *User) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	stored, ok := m.store.users[user.ID]
+	if !ok || stored.Version != user.Version {
+		return ErrEditConflict
+	}
+	if m.store.emailTaken(user) {
+		return ErrDuplicateEmail
+	}
+	user.Version++
+	*stored = *user
+	return nil
+}
+
+func (m memoryUserModel) GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	token, ok := m.store.tokens[string(tokenHash[:])]
+	if !ok || token.Scope != tokenScope || !token.Expiry.After(time.Now()) {
+		return nil, ErrRecordNotFound
+	}
+	user, ok := m.store.users[token.UserID]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	clone := *user
+	return &clone, nil
+}
+
+type memoryTokenModel struct {
+	store *memoryStore
+}
+
+func (m memoryTokenModel) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	err = m.Insert(ctx, token)
+	return token, err
+}
+
+func (m memoryTokenModel) Insert(ctx context.Context, token *Token) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	stored := *token
+	stored.Plaintext = ""
+	m.store.tokens[string(token.Hash)] = &stored
+	return nil
+}
+
+func (m memoryTokenModel) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	for hash, token := range m.store.tokens {
+		if token.Scope == scope && token.UserID == userID {
+			delete(m.store.tokens, hash)
+		}
+	}
+	return nil
+}
+
+type memoryPermissionModel struct {
+	store *memoryStore
+}
+
+func (m memoryPermissionModel) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	var permissions Permissions
+	return append(permissions, m.store.permissions[userID]...), nil
+}
+
+// AddForUser grants the codes that exist, ignoring the others like the INSERT ... SELECT
+// of PermissionModel.AddForUser does.
+func (m memoryPermissionModel) AddForUser(ctx context.Context, userID int64, codes ...string) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	for _, code := range codes {
+		if knownPermissions.Include(code) && !m.store.permissions[userID].Include(code) {
+			m.store.permissions[userID] = append(m.store.permissions[userID], code)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+const (
+	MergeKeepTarget = "target"
+	MergeKeepSource = "source"
+)
+
+// MergeFields are the scalar movie fields whose conflicts are resolved by a merge
+// strategy.
+var MergeFields = []string{
+	"title", "year", "runtime", "tagline", "synopsis", "original_language",
+	"external_ids", "release_dates", "certifications",
+}
+
+// MergeMovies folds source into target. Genres are unioned, a missing poster, backdrop
+// or collection is taken from the source and every field in MergeFields is taken from whichever movie the
+// strategy names, unless overrides names a different one for that field. Entries of the
+// external ids, release dates and certifications present on only one of the movies are
+// always kept.
+func MergeMovies(target, source *Movie, strategy string, overrides map[string]string) {
+	keepSource := func(field string) bool {
+		if choice, ok := overrides[field]; ok {
+			return choice == MergeKeepSource
+		}
+		return strategy == MergeKeepSource
+	}
+
+	if keepSource("title") {
+		target.Title = source.Title
+	}
+	if keepSource("year") {
+		target.Year = source.Year
+	}
+	if keepSource("runtime") {
+		target.Runtime = source.Runtime
+	}
+
+	if keepSource("tagline") {
+		target.Tagline = source.Tagline
+	}
+	if keepSource("synopsis") {
+		target.Synopsis = source.Synopsis
+	}
+	if keepSource("original_language") {
+		target.OriginalLanguage = source.OriginalLanguage
+	}
+
+	target.ExternalIDs = mergeMaps(target.ExternalIDs, source.ExternalIDs, keepSource("external_ids"))
+	target.ReleaseDates = mergeMaps(target.ReleaseDates, source.ReleaseDates, keepSource("release_dates"))
+	target.Certifications = mergeMaps(target.Certifications, source.Certifications, keepSource("certifications"))
+
+	target.Genres = append(target.Genres, difference(source.Genres, target.Genres)...)
+
+	if target.PosterKey == "" {
+		target.PosterKey, target.Poster = source.PosterKey, source.Poster
+	}
+	if target.BackdropKey == "" {
+		target.BackdropKey, target.Backdrop = source.BackdropKey, source.Backdrop
+	}
+	if target.Collection == nil {
+		target.Collection = source.Collection
+	}
+}
+
+// mergeMaps returns the union of target and source. Keys present in both take the
+// source's value if keepSource is set.
+func mergeMaps[M ~map[string]string](target, source M, keepSource bool) M {
+	merged := M{}
+	for key, value := range source {
+		merged[key] = value
+	}
+	for key, value := range target {
+		if _, conflict := merged[key]; !conflict || !keepSource {
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// Merge saves the result of MergeMovies. In one transaction the source movie is moved
+// to the trash, rows that depend on it are handed over to the target, the target is
+// updated (with a new revision credited to editorID) and a redirect from the source id
+// to the target is recorded. The source keeps its revisions as a record of what was
+// merged. Both movies must still be at the versions they were read at, otherwise
+// ErrEditConflict is returned.
+func (m *MovieModel) Merge(ctx context.Context, target, source *Movie, editorID int64) (err error) {
+	ctx, endSpan := startSpan(ctx, "MovieModel.Merge")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Batch)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The source gives up its external ids and artwork first, so the unique indexes
+	// allow the target to take them over.
+	query := `
+UPDATE movies SET deleted_at=NOW(),external_ids='{}',poster_key=NULL,poster=NULL,backdrop_key=NULL,backdrop=NULL
+WHERE id=$1 AND version=$2 AND deleted_at IS NULL`
+	result, err := tx.ExecContext(ctx, query, source.ID, source.Version)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	// The target takes over the source's place in a collection, unless it is already in
+	// one itself.
+	_, err = tx.ExecContext(ctx, `
+UPDATE collection_movies SET movie_id=$1
+WHERE movie_id=$2 AND NOT EXISTS (SELECT 1 FROM collection_movies WHERE movie_id=$1)`, target.ID, source.ID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM collection_movies WHERE movie_id=$1`, source.ID)
+	if err != nil {
+		return err
+	}
+
+	// Translations the target lacks are taken from the source. The rest stay with the
+	// source, like its revisions.
+	_, err = tx.ExecContext(ctx, `
+UPDATE movie_translations SET movie_id=$1
+WHERE movie_id=$2 AND locale NOT IN (SELECT locale FROM movie_translations WHERE movie_id=$1)`, target.ID, source.ID)
+	if err != nil {
+		return err
+	}
+
+	err = m.updateTx(ctx, tx, target, editorID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+UPDATE movies SET poster_key=NULLIF($1, ''),poster=$2,backdrop_key=NULLIF($3, ''),backdrop=$4 WHERE id=$5`,
+		target.PosterKey, target.Poster, target.BackdropKey, target.Backdrop, target.ID)
+	if err != nil {
+		return err
+	}
+
+	// Point existing redirects to the source at the target, so that chains of merges
+	// never take more than one hop.
+	_, err = tx.ExecContext(ctx, `UPDATE movie_redirects SET new_id=$1 WHERE new_id=$2`, target.ID, source.ID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+INSERT INTO movie_redirects (old_id, new_id) VALUES ($1, $2)
+ON CONFLICT (old_id) DO UPDATE SET new_id = EXCLUDED.new_id`, source.ID, target.ID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetRedirect returns the id of the movie that the movie with the given id was merged
+// into.
+func (m *MovieModel) GetRedirect(ctx context.Context, id int64) (_ int64, err error) {
+	query := `
+SELECT movie_redirects.new_id
+FROM movie_redirects
+INNER JOIN movies ON movies.id = movie_redirects.new_id
+WHERE movie_redirects.old_id = $1 AND movies.deleted_at IS NULL`
+	ctx, endSpan := startSpan(ctx, "MovieModel.GetRedirect")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
+	defer cancel()
+
+	var newID int64
+	err = m.DB.QueryRowContext(ctx, query, id).Scan(&newID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+	return newID, nil
+}
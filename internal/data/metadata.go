@@ -0,0 +1,111 @@
+package data
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"greenlight.darkhanomirbay/internal/validator"
+	"regexp"
+	"time"
+)
+
+var (
+	// LanguageRX matches ISO 639 language codes, such as "en" or "fil".
+	LanguageRX = regexp.MustCompile(`^[a-z]{2,3}$`)
+	// CountryRX matches ISO 3166-1 alpha-2 country codes, such as "US".
+	CountryRX       = regexp.MustCompile(`^[A-Z]{2}$`)
+	certificationRX = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9+\-. ]{0,15}$`)
+)
+
+// CertificationSystems lists the ratings that may be given in the countries whose
+// rating systems we know. Ratings for other countries only have to look like one.
+var CertificationSystems = map[string][]string{
+	"US": {"G", "PG", "PG-13", "R", "NC-17"},
+	"GB": {"U", "PG", "12A", "12", "15", "18", "R18"},
+	"DE": {"0", "6", "12", "16", "18"},
+	"FR": {"U", "10", "12", "16", "18"},
+	"AU": {"G", "PG", "M", "MA15+", "R18+", "X18+"},
+	"CA": {"G", "PG", "14A", "18A", "R", "A"},
+}
+
+// ReleaseDates maps a country code to the date the movie was released there, formatted
+// as YYYY-MM-DD.
+type ReleaseDates map[string]string
+
+func (d *ReleaseDates) Scan(src any) error {
+	return scanJSONMap((*map[string]string)(d), src)
+}
+func (d ReleaseDates) Value() (driver.Value, error) {
+	return jsonMapValue(d)
+}
+
+// Certifications maps a country code to the age rating the movie was given there.
+type Certifications map[string]string
+
+func (c *Certifications) Scan(src any) error {
+	return scanJSONMap((*map[string]string)(c), src)
+}
+func (c Certifications) Value() (driver.Value, error) {
+	return jsonMapValue(c)
+}
+
+func scanJSONMap(m *map[string]string, src any) error {
+	switch src := src.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(src, m)
+	case string:
+		return json.Unmarshal([]byte(src), m)
+	default:
+		return errors.New("unsupported json object value")
+	}
+}
+func jsonMapValue(m map[string]string) (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	js, err := json.Marshal(m)
+	return string(js), err
+}
+
+// ValidateMetadata checks the descriptive fields of a movie other than its title, year,
+// runtime and genres.
+func ValidateMetadata(v *validator.Validator, movie *Movie) {
+	v.Check(len(movie.Synopsis) <= 5000, "synopsis", "must not be more than 5000 bytes long")
+	v.Check(len(movie.Tagline) <= 300, "tagline", "must not be more than 300 bytes long")
+	if movie.OriginalLanguage != "" {
+		v.Check(validator.Matches(movie.OriginalLanguage, LanguageRX), "original_language", "must be a lower case ISO 639 language code")
+	}
+
+	v.Check(len(movie.ReleaseDates) <= 250, "release_dates", "must not contain more than 250 countries")
+	for country, date := range movie.ReleaseDates {
+		if !validator.Matches(country, CountryRX) {
+			v.AddError("release_dates", "must be keyed by ISO 3166-1 alpha-2 country codes")
+			continue
+		}
+		released, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			v.AddError("release_dates."+country, "must be a date formatted as YYYY-MM-DD")
+			continue
+		}
+		v.Check(released.Year() >= 1888, "release_dates."+country, "must not be before 1888")
+		if movie.Year != 0 {
+			v.Check(int32(released.Year()) >= movie.Year, "release_dates."+country, "must not be before the year of the movie")
+		}
+	}
+
+	v.Check(len(movie.Certifications) <= 250, "certifications", "must not contain more than 250 countries")
+	for country, rating := range movie.Certifications {
+		if !validator.Matches(country, CountryRX) {
+			v.AddError("certifications", "must be keyed by ISO 3166-1 alpha-2 country codes")
+			continue
+		}
+		if ratings, ok := CertificationSystems[country]; ok {
+			v.Check(validator.PermittedValue(rating, ratings...), "certifications."+country, "must be a rating used in "+country)
+			continue
+		}
+		v.Check(validator.Matches(rating, certificationRX), "certifications."+country, "must be a valid rating")
+	}
+}
@@ -1,8 +1,11 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"github.com/lib/pq"
+	"time"
 )
 
 var (
@@ -10,25 +13,118 @@ var (
 	ErrEditConflict   = errors.New("edit conflict")
 )
 
+// Timeouts are the deadlines the models give their database work, on top of any
+// deadline or cancellation of the context they are called with.
+type Timeouts struct {
+	// Query bounds single queries and short transactions.
+	Query time.Duration
+	// Batch bounds bulk work, such as merging movies, purging the trash and each batch
+	// of an import.
+	Batch time.Duration
+	// Refresh bounds the recomputation of the movie statistics.
+	Refresh time.Duration
+}
+
+// DefaultTimeouts are the deadlines used unless configured otherwise.
+var DefaultTimeouts = Timeouts{Query: 3 * time.Second, Batch: 30 * time.Second, Refresh: time.Minute}
+
+// QueryCanceled reports whether err comes from database work that was abandoned
+// because its context was cancelled or ran out of time. PostgreSQL reports a cancelled
+// query as query_canceled rather than with the context's error.
+func QueryCanceled(err error) bool {
+	var pqErr *pq.Error
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.As(err, &pqErr) && pqErr.Code == "57014"
+}
+
+// The repository interfaces describe the storage the handlers rely on. NewModels
+// provides PostgreSQL implementations of them and NewMemoryModels in-memory ones.
+type (
+	MovieRepository interface {
+		Insert(ctx context.Context, movie *Movie, editorID int64) error
+		Get(ctx context.Context, id int64) (*Movie, error)
+		Update(ctx context.Context, movie *Movie, editorID int64) error
+		Delete(ctx context.Context, id int64) error
+		Restore(ctx context.Context, id int64) (*Movie, error)
+		Purge(ctx context.Context, id int64) (PurgedMovie, error)
+		PurgeTrashed(ctx context.Context, cutoff time.Time) ([]PurgedMovie, error)
+		GetAllTrashed(ctx context.Context, filters Filters) ([]*Movie, Metadata, error)
+		GetAll(ctx context.Context, title string, genres []string, externalIDs ExternalIDs, originalLanguage string, certifications Certifications, filters Filters) ([]*Movie, Metadata, error)
+		Export(ctx context.Context, title string, genres []string, externalIDs ExternalIDs, originalLanguage string, certifications Certifications, batchSize int, fn func(*Movie) error) error
+		BeginImport(ctx context.Context, savepoints bool, editorID int64) (MovieImporter, error)
+		FindDuplicates(ctx context.Context, movie *Movie) ([]*Movie, error)
+		Merge(ctx context.Context, target, source *Movie, editorID int64) error
+		GetRedirect(ctx context.Context, id int64) (int64, error)
+		SetPoster(ctx context.Context, movie *Movie) error
+		SetBackdrop(ctx context.Context, movie *Movie) error
+		GetSimilar(ctx context.Context, movie *Movie, filters Filters) ([]*SimilarMovie, Metadata, error)
+	}
+	// MovieImporter bulk loads movies as a unit, see MovieImport.
+	MovieImporter interface {
+		CopyBatch(ctx context.Context, movies []*Movie) error
+		Commit() error
+		Rollback() error
+	}
+	MovieRevisionRepository interface {
+		Get(ctx context.Context, movieID int64, version int32) (*MovieRevision, error)
+		GetAllForMovie(ctx context.Context, movieID int64, filters Filters) ([]*MovieRevision, Metadata, error)
+	}
+	UserRepository interface {
+		Insert(ctx context.Context, user *User) error
+		GetByEmail(ctx context.Context, email string) (*User, error)
+		Update(ctx context.Context, user *User) error
+		GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error)
+	}
+	TokenRepository interface {
+		New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error)
+		Insert(ctx context.Context, token *Token) error
+		DeleteAllForUser(ctx context.Context, scope string, userID int64) error
+	}
+	PermissionRepository interface {
+		GetAllForUser(ctx context.Context, userID int64) (Permissions, error)
+		AddForUser(ctx context.Context, userID int64, codes ...string) error
+	}
+	StatsRepository interface {
+		GetMovieStats(ctx context.Context) (*MovieStats, error)
+		RefreshMovieStats(ctx context.Context) error
+	}
+	CollectionRepository interface {
+		Insert(ctx context.Context, collection *Collection) error
+		Get(ctx context.Context, id int64) (*Collection, error)
+		GetAll(ctx context.Context, name string, filters Filters) ([]*Collection, Metadata, error)
+		GetMovies(ctx context.Context, id int64) ([]*Movie, error)
+		Update(ctx context.Context, collection *Collection, setMovies bool) error
+		Delete(ctx context.Context, id int64) error
+	}
+	MovieTranslationRepository interface {
+		Upsert(ctx context.Context, translation *MovieTranslation) error
+		GetAllForMovie(ctx context.Context, movieID int64) ([]*MovieTranslation, error)
+		Delete(ctx context.Context, movieID int64, locale string) error
+		Localize(ctx context.Context, movies []*Movie, locales []string) error
+	}
+)
+
 type Models struct {
-	Movies      MovieModel
-	Users       UserModel
-	Tokens      TokenModel
-	Permissions PermissionModel
-	//Movies interface {
-	//	Insert(movie *Movie) error
-	//	Get(id int64) (Movie, error)
-	//	Update(movie *Movie) error
-	//	Delete(id int64) error
-	//}
+	Movies       MovieRepository
+	Revisions    MovieRevisionRepository
+	Users        UserRepository
+	Tokens       TokenRepository
+	Permissions  PermissionRepository
+	Stats        StatsRepository
+	Collections  CollectionRepository
+	Translations MovieTranslationRepository
 }
 
-func NewModels(db *sql.DB) Models {
+func NewModels(db *sql.DB, timeouts Timeouts) Models {
 	return Models{
-		Movies:      MovieModel{DB: db},
-		Users:       UserModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Permissions: PermissionModel{DB: db},
+		Movies:       &MovieModel{DB: db, Timeouts: timeouts},
+		Revisions:    MovieRevisionModel{DB: db, Timeouts: timeouts},
+		Users:        UserModel{DB: db, Timeouts: timeouts},
+		Tokens:       TokenModel{DB: db, Timeouts: timeouts},
+		Permissions:  PermissionModel{DB: db, Timeouts: timeouts},
+		Stats:        StatsModel{DB: db, Timeouts: timeouts},
+		Collections:  CollectionModel{DB: db, Timeouts: timeouts},
+		Translations: MovieTranslationModel{DB: db, Timeouts: timeouts},
 	}
 }
 
@@ -3,53 +3,156 @@ package data
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/lib/pq"
 	"greenlight.darkhanomirbay/internal/validator"
+	"strings"
 	"time"
 )
 
 type Movie struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"-"` // - (hyphen)directive use for hiding field
-	Title     string    `json:"title"`
-	Year      int32     `json:"year,omitempty"`
-	Runtime   Runtime   `json:"runtime,omitempty,string"` // string directive use for represent field in JSON STRING
+	ID        int64      `json:"id"`
+	CreatedAt time.Time  `json:"-"`                    // - (hyphen)directive use for hiding field
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` // only set for movies in the trash
+	Title     string     `json:"title"`
+	// OriginalTitle and Locale are only set when the movie was localized and Title (and
+	// Synopsis, if one was translated) holds a translation.
+	OriginalTitle    string  `json:"original_title,omitempty"`
+	Locale           string  `json:"locale,omitempty"`
+	Tagline          string  `json:"tagline,omitempty"`
+	Synopsis         string  `json:"synopsis,omitempty"`
+	OriginalLanguage string  `json:"original_language,omitempty"`
+	Year             int32   `json:"year,omitempty"`
+	Runtime          Runtime `json:"runtime,omitempty"`
 	// key-word omitempty uses for hide empty field
-	Genres  []string `json:"genres,omitempty"`
-	Version int32    `json:"version"`
+	Genres         []string         `json:"genres,omitempty"`
+	PosterKey      string           `json:"-"`
+	Poster         Artwork          `json:"poster,omitempty"`
+	BackdropKey    string           `json:"-"`
+	Backdrop       Artwork          `json:"backdrop,omitempty"`
+	ExternalIDs    ExternalIDs      `json:"external_ids,omitempty"`
+	ReleaseDates   ReleaseDates     `json:"release_dates,omitempty"`
+	Certifications Certifications   `json:"certifications,omitempty"`
+	Collection     *MovieCollection `json:"collection,omitempty"` // read-only, managed through the collection
+	Version        int32            `json:"version,omitempty"`
+	// runtimeFormat is the format Runtime is written in as JSON.
+	runtimeFormat RuntimeFormat
 }
 
-type MovieModel struct {
-	DB *sql.DB
+// SetRuntimeFormat chooses the format the runtime is written in as JSON.
+func (movie *Movie) SetRuntimeFormat(format RuntimeFormat) {
+	movie.runtimeFormat = format
 }
 
-func (m *MovieModel) Insert(movie *Movie) error {
-	query := `INSERT INTO movies(title,year,runtime,genres) VALUES($1,$2,$3,$4) RETURNING id,created_at,version `
-	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
-	return m.DB.QueryRow(query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+// movieJSON is a movie as written in JSON, with the runtime in the chosen format.
+type movieJSON struct {
+	*movieFields
+	Runtime *FormattedRuntime `json:"runtime,omitempty"`
 }
-func (m *MovieModel) Get(id int64) (*Movie, error) {
-	if id < 1 {
-		return nil, ErrRecordNotFound
+
+// movieFields has the fields of Movie without its methods, so that marshalling it does
+// not call Movie.MarshalJSON again.
+type movieFields Movie
+
+func (movie *Movie) toJSON() movieJSON {
+	js := movieJSON{movieFields: (*movieFields)(movie)}
+	if movie.Runtime != 0 {
+		js.Runtime = &FormattedRuntime{Runtime: movie.Runtime, Format: movie.runtimeFormat}
 	}
-	query := `
-SELECT id, created_at, title, year, runtime, genres, version
-FROM movies
-WHERE id = $1`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-	var movie Movie
-	err := m.DB.QueryRowContext(ctx, query, id).Scan( // Use scan for save fields into movie(copy)
+	return js
+}
+
+func (movie Movie) MarshalJSON() ([]byte, error) {
+	return json.Marshal(movie.toJSON())
+}
+
+// HideEditorFields clears the fields that only editors need, before the movie is shown
+// to an anonymous user.
+func (movie *Movie) HideEditorFields() {
+	movie.Version = 0
+	movie.DeletedAt = nil
+}
+
+// movieColumns is the select list for reading a whole movie, matching the destinations
+// returned by Movie.scanFields.
+const movieColumns = `id, created_at, deleted_at, title, year, runtime, genres, COALESCE(poster_key, ''), poster,
+	COALESCE(backdrop_key, ''), backdrop, external_ids, tagline, synopsis, original_language, release_dates, certifications, movie_collection(id), version`
+
+func (movie *Movie) scanFields() []any {
+	return []any{
 		&movie.ID, // use & this for record field into movie
 		&movie.CreatedAt,
+		&movie.DeletedAt,
 		&movie.Title,
 		&movie.Year,
 		&movie.Runtime,
 		pq.Array(&movie.Genres), // pq.Array for convert text[] PostgresSQL's field to our array
+		&movie.PosterKey,
+		&movie.Poster,
+		&movie.BackdropKey,
+		&movie.Backdrop,
+		&movie.ExternalIDs,
+		&movie.Tagline,
+		&movie.Synopsis,
+		&movie.OriginalLanguage,
+		&movie.ReleaseDates,
+		&movie.Certifications,
+		jsonColumn{&movie.Collection},
 		&movie.Version,
-	)
+	}
+}
+
+type MovieModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+// Insert creates the movie and records its first revision, crediting editorID.
+func (m *MovieModel) Insert(ctx context.Context, movie *Movie, editorID int64) (err error) {
+	query := `
+INSERT INTO movies(title,year,runtime,genres,external_ids,tagline,synopsis,original_language,release_dates,certifications)
+VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) RETURNING id,created_at,version `
+	args := []any{
+		movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.ExternalIDs,
+		movie.Tagline, movie.Synopsis, movie.OriginalLanguage, movie.ReleaseDates, movie.Certifications,
+	}
+	ctx, endSpan := startSpan(ctx, "MovieModel.Insert")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	if err != nil {
+		return externalIDError(err)
+	}
+	err = insertRevision(ctx, tx, movie, editorID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+func (m *MovieModel) Get(ctx context.Context, id int64) (_ *Movie, err error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+SELECT ` + movieColumns + `
+FROM movies
+WHERE id = $1 AND deleted_at IS NULL`
+	ctx, endSpan := startSpan(ctx, "MovieModel.Get")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
+	defer cancel()
+	var movie Movie
+	err = m.DB.QueryRowContext(ctx, query, id).Scan(movie.scanFields()...) // Use scan for save fields into movie(copy)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -61,31 +164,74 @@ WHERE id = $1`
 	}
 	return &movie, err
 }
-func (m *MovieModel) Update(movie *Movie) error {
-	query := `UPDATE movies SET title=$1,year=$2,runtime=$3,genres=$4,version=version+1 WHERE id=$5 AND version=$6 RETURNING version `
-	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.ID, movie.Version}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+
+// Update saves the movie if its version still matches the stored one and records the
+// new version as a revision credited to editorID. Movies created before revisions were
+// kept, or loaded through an import, have no revision for their current version yet, so
+// that one is snapshotted first without an editor.
+func (m *MovieModel) Update(ctx context.Context, movie *Movie, editorID int64) (err error) {
+	ctx, endSpan := startSpan(ctx, "MovieModel.Update")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = m.updateTx(ctx, tx, movie, editorID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+func (m *MovieModel) updateTx(ctx context.Context, tx *sql.Tx, movie *Movie, editorID int64) error {
+	query := `
+UPDATE movies SET title=$1,year=$2,runtime=$3,genres=$4,external_ids=$5,
+	tagline=$6,synopsis=$7,original_language=$8,release_dates=$9,certifications=$10,version=version+1
+WHERE id=$11 AND version=$12 AND deleted_at IS NULL RETURNING version `
+	args := []any{
+		movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.ExternalIDs,
+		movie.Tagline, movie.Synopsis, movie.OriginalLanguage, movie.ReleaseDates, movie.Certifications,
+		movie.ID, movie.Version,
+	}
+
+	_, err := tx.ExecContext(ctx, `
+INSERT INTO movie_revisions (movie_id, version, title, year, runtime, genres,
+	tagline, synopsis, original_language, external_ids, release_dates, certifications, created_at)
+SELECT id, version, title, year, runtime, genres,
+	tagline, synopsis, original_language, external_ids, release_dates, certifications, created_at
+FROM movies
+WHERE id = $1 AND version = $2
+ON CONFLICT DO NOTHING`, movie.ID, movie.Version)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
 		default:
-			return err
+			return externalIDError(err)
 		}
 	}
-	return nil
-
+	return insertRevision(ctx, tx, movie, editorID)
 }
-func (m *MovieModel) Delete(id int64) error {
+
+// Delete moves a movie to the trash. It stays there until it is restored or purged.
+func (m *MovieModel) Delete(ctx context.Context, id int64) (err error) {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
-	query := `DELETE FROM movies WHERE id=$1`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	query := `UPDATE movies SET deleted_at=NOW() WHERE id=$1 AND deleted_at IS NULL`
+	ctx, endSpan := startSpan(ctx, "MovieModel.Delete")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
 	defer cancel()
 
 	result, err := m.DB.ExecContext(ctx, query, id)
@@ -102,7 +248,158 @@ func (m *MovieModel) Delete(id int64) error {
 	}
 	return nil
 }
-func (m *MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+
+// Restore takes a movie out of the trash and returns the restored record.
+func (m *MovieModel) Restore(ctx context.Context, id int64) (_ *Movie, err error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `UPDATE movies SET deleted_at=NULL WHERE id=$1 AND deleted_at IS NOT NULL
+RETURNING ` + movieColumns
+	ctx, endSpan := startSpan(ctx, "MovieModel.Restore")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
+	defer cancel()
+
+	var movie Movie
+	err = m.DB.QueryRowContext(ctx, query, id).Scan(movie.scanFields()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &movie, nil
+}
+
+// PurgedMovie is what is left of a purged movie: the stored objects of its poster and
+// backdrop, which the caller is responsible for deleting.
+type PurgedMovie struct {
+	ID          int64
+	PosterKey   string
+	Poster      Artwork
+	BackdropKey string
+	Backdrop    Artwork
+}
+
+// purgedColumns is the returning list of the purge queries, matching the destinations
+// returned by PurgedMovie.scanFields.
+const purgedColumns = `id, COALESCE(poster_key, ''), poster, COALESCE(backdrop_key, ''), backdrop`
+
+func (purged *PurgedMovie) scanFields() []any {
+	return []any{&purged.ID, &purged.PosterKey, &purged.Poster, &purged.BackdropKey, &purged.Backdrop}
+}
+
+// Purge permanently deletes a movie. Only movies that are already in the trash can be
+// purged.
+func (m *MovieModel) Purge(ctx context.Context, id int64) (_ PurgedMovie, err error) {
+	if id < 1 {
+		return PurgedMovie{}, ErrRecordNotFound
+	}
+	query := `DELETE FROM movies WHERE id=$1 AND deleted_at IS NOT NULL RETURNING ` + purgedColumns
+	ctx, endSpan := startSpan(ctx, "MovieModel.Purge")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
+	defer cancel()
+
+	var purged PurgedMovie
+	err = m.DB.QueryRowContext(ctx, query, id).Scan(purged.scanFields()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return PurgedMovie{}, ErrRecordNotFound
+		default:
+			return PurgedMovie{}, err
+		}
+	}
+	return purged, nil
+}
+
+// PurgeTrashed permanently deletes every movie that was moved to the trash before
+// cutoff and returns what is left of them.
+func (m *MovieModel) PurgeTrashed(ctx context.Context, cutoff time.Time) (_ []PurgedMovie, err error) {
+	query := `DELETE FROM movies WHERE deleted_at < $1 RETURNING ` + purgedColumns
+	ctx, endSpan := startSpan(ctx, "MovieModel.PurgeTrashed")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Batch)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	purged := []PurgedMovie{}
+	for rows.Next() {
+		var movie PurgedMovie
+		err := rows.Scan(movie.scanFields()...)
+		if err != nil {
+			return nil, err
+		}
+		purged = append(purged, movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return purged, nil
+}
+func (m *MovieModel) GetAllTrashed(ctx context.Context, filters Filters) (_ []*Movie, _ Metadata, err error) {
+	query := fmt.Sprintf(`SELECT count(*) OVER(), `+movieColumns+`
+	FROM movies
+	WHERE deleted_at IS NOT NULL
+	ORDER BY %s %s,id ASC
+	LIMIT $1 OFFSET $2`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, endSpan := startSpan(ctx, "MovieModel.GetAllTrashed")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	movies := []*Movie{}
+	totalRecords := 0
+	for rows.Next() {
+		var movie Movie
+		err := rows.Scan(append([]any{&totalRecords}, movie.scanFields()...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		movies = append(movies, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return movies, metadata, nil
+}
+
+// movieSearchConditions selects the live movies matching the search filters of GetAll
+// and Export, passed as $1 to $5.
+const movieSearchConditions = `(to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = ''
+		OR EXISTS (
+			SELECT 1 FROM movie_translations
+			WHERE movie_translations.movie_id = movies.id
+			AND to_tsvector(locale_ts_config(locale), movie_translations.title) @@ plainto_tsquery(locale_ts_config(locale), $1)))
+	AND (genres @> $2 OR $2 = '{}')
+	AND external_ids @> $3
+	AND (original_language = $4 OR $4 = '')
+	AND certifications @> $5
+	AND deleted_at IS NULL`
+
+// GetAll returns a page of the movies matching the title search, containing all of the
+// genres and linked to all of the given external ids. The title search also matches
+// translated titles, using the text search configuration of their language. An empty
+// originalLanguage matches every movie, and so do empty certifications; otherwise the
+// movies must have been given all of the listed ratings.
+func (m *MovieModel) GetAll(ctx context.Context, title string, genres []string, externalIDs ExternalIDs, originalLanguage string, certifications Certifications, filters Filters) (_ []*Movie, _ Metadata, err error) {
 	//query := `SELECT id,created_at,title,year,runtime,genres,version FROM movies ORDER BY id`
 	// need to write full title for example /v1/movies?title=the+breakfast+club
 	//	query := `SELECT id,created_at,title,year,runtime,genres,version FROM movies WHERE (LOWER(title)=LOWER($1) or $1='')
@@ -126,16 +423,18 @@ func (m *MovieModel) GetAll(title string, genres []string, filters Filters) ([]*
 	//ORDER BY %s %s,id ASC
 	//LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
 	//query with metadata count(*) over()
-	query := fmt.Sprintf(`SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version
+	query := fmt.Sprintf(`SELECT count(*) OVER(), `+movieColumns+`
 	FROM movies
-	WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-	AND (genres @> $2 OR $2 = '{}') 
+	WHERE `+movieSearchConditions+`
 	ORDER BY %s %s,id ASC
-	LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+	LIMIT $6 OFFSET $7`, filters.sortColumn(), filters.sortDirection())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, endSpan := startSpan(ctx, "MovieModel.GetAll")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
 	defer cancel()
-	rows, err := m.DB.QueryContext(ctx, query, title, pq.Array(genres), filters.limit(), filters.offset())
+	args := []any{title, pq.Array(genres), externalIDs, originalLanguage, certifications, filters.limit(), filters.offset()}
+	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -147,7 +446,7 @@ func (m *MovieModel) GetAll(title string, genres []string, filters Filters) ([]*
 	for rows.Next() {
 		var movie Movie
 
-		err := rows.Scan(&totalRecords, &movie.ID, &movie.CreatedAt, &movie.Title, &movie.Year, &movie.Runtime, pq.Array(&movie.Genres), &movie.Version)
+		err := rows.Scan(append([]any{&totalRecords}, movie.scanFields()...)...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
@@ -161,6 +460,231 @@ func (m *MovieModel) GetAll(title string, genres []string, filters Filters) ([]*
 
 	return movies, metadata, nil
 }
+
+// Export calls fn for every movie matching the same filters as GetAll in id order.
+// Rows are read through a server-side cursor in batches of batchSize inside a read-only
+// repeatable read transaction, so the export sees a consistent snapshot while only one
+// batch is held in memory. Cancelling ctx aborts the export.
+func (m *MovieModel) Export(ctx context.Context, title string, genres []string, externalIDs ExternalIDs, originalLanguage string, certifications Certifications, batchSize int, fn func(*Movie) error) (err error) {
+	ctx, endSpan := startSpan(ctx, "MovieModel.Export")
+	defer endSpan(&err)
+
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+DECLARE movie_export NO SCROLL CURSOR FOR
+SELECT ` + movieColumns + `
+FROM movies
+WHERE ` + movieSearchConditions + `
+ORDER BY id`
+	_, err = tx.ExecContext(ctx, query, title, pq.Array(genres), externalIDs, originalLanguage, certifications)
+	if err != nil {
+		return err
+	}
+
+	fetch := fmt.Sprintf(`FETCH %d FROM movie_export`, batchSize)
+	for {
+		rows, err := tx.QueryContext(ctx, fetch)
+		if err != nil {
+			return err
+		}
+		fetched := 0
+		for rows.Next() {
+			var movie Movie
+			err = rows.Scan(movie.scanFields()...)
+			if err == nil {
+				err = fn(&movie)
+			}
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			fetched++
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+		if fetched < batchSize {
+			return nil
+		}
+	}
+}
+
+var ErrImportBatchRejected = errors.New("import batch rejected")
+
+// ImportRowsRejectedError is returned by CopyBatch when an import with savepoints finds
+// rows that the database rejects. The other rows of the batch are copied. Rows maps the
+// index of each rejected row in the batch to the reason it was rejected.
+type ImportRowsRejectedError struct {
+	Rows map[int]string
+}
+
+func (e *ImportRowsRejectedError) Error() string {
+	return fmt.Sprintf("%s: %d rows rejected", ErrImportBatchRejected, len(e.Rows))
+}
+func (e *ImportRowsRejectedError) Unwrap() error {
+	return ErrImportBatchRejected
+}
+
+// MovieImport bulk loads movies with COPY inside a single transaction, recording the
+// first revision of every movie. When savepoints is set every batch is wrapped in its
+// own savepoint, so a batch rejected by the database can be rolled back without losing
+// the batches copied before it, and the rows that caused it can be picked out.
+type MovieImport struct {
+	tx         *sql.Tx
+	savepoints bool
+	editorID   int64
+	timeout    time.Duration
+}
+
+// BeginImport starts the import transaction, which is rolled back if ctx is cancelled
+// before it is committed. The revisions of the imported movies are credited to
+// editorID.
+func (m *MovieModel) BeginImport(ctx context.Context, savepoints bool, editorID int64) (MovieImporter, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Rows are copied into a staging table first, so that the movies and their
+	// revisions can then be inserted together in one statement.
+	_, err = tx.ExecContext(ctx, `
+CREATE TEMPORARY TABLE movie_import_rows (
+	position integer NOT NULL,
+	title text NOT NULL,
+	year integer NOT NULL,
+	runtime integer NOT NULL,
+	genres text[] NOT NULL,
+	external_ids jsonb NOT NULL,
+	tagline text NOT NULL,
+	synopsis text NOT NULL,
+	original_language text NOT NULL,
+	release_dates jsonb NOT NULL,
+	certifications jsonb NOT NULL
+) ON COMMIT DROP`)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return &MovieImport{tx: tx, savepoints: savepoints, editorID: editorID, timeout: m.Timeouts.Batch}, nil
+}
+func (i *MovieImport) CopyBatch(ctx context.Context, movies []*Movie) (err error) {
+	ctx, endSpan := startSpan(ctx, "MovieImport.CopyBatch")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, i.timeout)
+	defer cancel()
+
+	err = i.copyBatch(ctx, movies)
+	if !i.savepoints || !errors.Is(err, ErrImportBatchRejected) {
+		return err
+	}
+
+	// Copy the rows of the rejected batch one at a time to find the ones at fault.
+	rejected := make(map[int]string)
+	for n, movie := range movies {
+		err := i.copyBatch(ctx, []*Movie{movie})
+		if err != nil {
+			if !errors.Is(err, ErrImportBatchRejected) {
+				return err
+			}
+			rejected[n] = strings.TrimPrefix(err.Error(), ErrImportBatchRejected.Error()+": ")
+		}
+	}
+	if len(rejected) == 0 {
+		return nil
+	}
+	return &ImportRowsRejectedError{Rows: rejected}
+}
+
+// copyBatch inserts movies, inside a savepoint if the import uses them. Rows rejected by
+// the database are reported as ErrImportBatchRejected.
+func (i *MovieImport) copyBatch(ctx context.Context, movies []*Movie) error {
+	if i.savepoints {
+		_, err := i.tx.ExecContext(ctx, `SAVEPOINT movie_import_batch`)
+		if err != nil {
+			return err
+		}
+	}
+	err := i.copy(ctx, movies)
+	if err != nil {
+		if i.savepoints {
+			_, rollbackErr := i.tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT movie_import_batch`)
+			if rollbackErr != nil {
+				return rollbackErr
+			}
+		}
+		if errors.Is(externalIDError(err), ErrDuplicateExternalID) {
+			return fmt.Errorf("%w: a movie with one of these external ids already exists", ErrImportBatchRejected)
+		}
+		// Data exceptions and integrity violations mean the rows themselves were
+		// rejected, anything else is a problem with the database.
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && (pqErr.Code.Class() == "22" || pqErr.Code.Class() == "23") {
+			return fmt.Errorf("%w: %s", ErrImportBatchRejected, pqErr.Message)
+		}
+		return err
+	}
+	if i.savepoints {
+		_, err = i.tx.ExecContext(ctx, `RELEASE SAVEPOINT movie_import_batch`)
+	}
+	return err
+}
+func (i *MovieImport) copy(ctx context.Context, movies []*Movie) error {
+	_, err := i.tx.ExecContext(ctx, `TRUNCATE movie_import_rows`)
+	if err != nil {
+		return err
+	}
+	stmt, err := i.tx.PrepareContext(ctx, pq.CopyIn("movie_import_rows", "position", "title", "year", "runtime", "genres",
+		"external_ids", "tagline", "synopsis", "original_language", "release_dates", "certifications"))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for n, movie := range movies {
+		_, err = stmt.ExecContext(ctx, n, movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres),
+			movie.ExternalIDs, movie.Tagline, movie.Synopsis, movie.OriginalLanguage, movie.ReleaseDates, movie.Certifications)
+		if err != nil {
+			return err
+		}
+	}
+	// An Exec without arguments flushes the buffered rows and completes the COPY.
+	_, err = stmt.ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+	err = stmt.Close()
+	if err != nil {
+		return err
+	}
+
+	query := `
+WITH inserted AS (
+	INSERT INTO movies (title, year, runtime, genres, external_ids, tagline, synopsis, original_language, release_dates, certifications)
+	SELECT title, year, runtime, genres, external_ids, tagline, synopsis, original_language, release_dates, certifications
+	FROM movie_import_rows
+	ORDER BY position
+	RETURNING id, version, title, year, runtime, genres, external_ids, tagline, synopsis, original_language, release_dates, certifications
+)
+INSERT INTO movie_revisions (movie_id, version, title, year, runtime, genres,
+	external_ids, tagline, synopsis, original_language, release_dates, certifications, user_id)
+SELECT id, version, title, year, runtime, genres,
+	external_ids, tagline, synopsis, original_language, release_dates, certifications, $1
+FROM inserted`
+	_, err = i.tx.ExecContext(ctx, query, i.editorID)
+	return err
+}
+func (i *MovieImport) Commit() error {
+	return i.tx.Commit()
+}
+func (i *MovieImport) Rollback() error {
+	return i.tx.Rollback()
+}
 func ValidateMovie(v *validator.Validator, movie *Movie) {
 	v.Check(movie.Title != "", "title", "must be provided")
 	v.Check(len(movie.Title) <= 500, "title", "must not be more than 500 bytes long")
@@ -173,6 +697,8 @@ func ValidateMovie(v *validator.Validator, movie *Movie) {
 	v.Check(len(movie.Genres) >= 1, "genres", "must contain at least 1 genre")
 	v.Check(len(movie.Genres) <= 5, "genres", "must not contain more than 5 genres")
 	v.Check(validator.Unique(movie.Genres), "genres", "must not contain duplicate values")
+	ValidateExternalIDs(v, movie.ExternalIDs)
+	ValidateMetadata(v, movie)
 }
 
 // MOCK MODELS (FOR UNIT TESTS)
@@ -4,7 +4,6 @@ import (
 	"context"
 	"database/sql"
 	"github.com/lib/pq"
-	"time"
 )
 
 type Permissions []string
@@ -19,17 +18,20 @@ func (p Permissions) Include(code string) bool {
 }
 
 type PermissionModel struct {
-	DB *sql.DB
+	DB       *sql.DB
+	Timeouts Timeouts
 }
 
-func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+func (m PermissionModel) GetAllForUser(ctx context.Context, userID int64) (_ Permissions, err error) {
 	query := `
 SELECT permissions.code
 FROM permissions
 INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
 INNER JOIN users ON users_permissions.user_id = users.id
 WHERE users.id = $1`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, endSpan := startSpan(ctx, "PermissionModel.GetAllForUser")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
 	defer cancel()
 	rows, err := m.DB.QueryContext(ctx, query, userID)
 	if err != nil {
@@ -50,12 +52,14 @@ WHERE users.id = $1`
 	}
 	return permissions, nil
 }
-func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
+func (m PermissionModel) AddForUser(ctx context.Context, userID int64, codes ...string) (err error) {
 	query := `
 INSERT INTO users_permissions
 SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, endSpan := startSpan(ctx, "PermissionModel.AddForUser")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
 	defer cancel()
-	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	_, err = m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
 	return err
 }
@@ -0,0 +1,262 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"time"
+)
+
+// MovieRevision is a snapshot of a movie as it was at a particular version. UserID is
+// the user who saved that version and is nil when it isn't known.
+type MovieRevision struct {
+	MovieID          int64          `json:"movie_id"`
+	Version          int32          `json:"version"`
+	Title            string         `json:"title"`
+	Year             int32          `json:"year"`
+	Runtime          Runtime        `json:"runtime"`
+	Genres           []string       `json:"genres"`
+	Tagline          string         `json:"tagline,omitempty"`
+	Synopsis         string         `json:"synopsis,omitempty"`
+	OriginalLanguage string         `json:"original_language,omitempty"`
+	ExternalIDs      ExternalIDs    `json:"external_ids,omitempty"`
+	ReleaseDates     ReleaseDates   `json:"release_dates,omitempty"`
+	Certifications   Certifications `json:"certifications,omitempty"`
+	UserID           *int64         `json:"user_id"`
+	CreatedAt        time.Time      `json:"created_at"`
+	// runtimeFormat is the format Runtime is written in as JSON.
+	runtimeFormat RuntimeFormat
+}
+
+// SetRuntimeFormat chooses the format the runtime is written in as JSON, including in
+// the changes returned by Diff.
+func (revision *MovieRevision) SetRuntimeFormat(format RuntimeFormat) {
+	revision.runtimeFormat = format
+}
+
+func (revision *MovieRevision) formattedRuntime() FormattedRuntime {
+	return FormattedRuntime{Runtime: revision.Runtime, Format: revision.runtimeFormat}
+}
+
+// revisionFields has the fields of MovieRevision without its methods, see movieFields.
+type revisionFields MovieRevision
+
+func (revision MovieRevision) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		*revisionFields
+		Runtime FormattedRuntime `json:"runtime"`
+	}{(*revisionFields)(&revision), revision.formattedRuntime()})
+}
+
+// revisionColumns is the select list for reading a revision, matching the destinations
+// returned by MovieRevision.scanFields.
+const revisionColumns = `movie_id, version, title, year, runtime, genres,
+	tagline, synopsis, original_language, external_ids, release_dates, certifications, user_id, created_at`
+
+func (revision *MovieRevision) scanFields() []any {
+	return []any{
+		&revision.MovieID,
+		&revision.Version,
+		&revision.Title,
+		&revision.Year,
+		&revision.Runtime,
+		pq.Array(&revision.Genres),
+		&revision.Tagline,
+		&revision.Synopsis,
+		&revision.OriginalLanguage,
+		&revision.ExternalIDs,
+		&revision.ReleaseDates,
+		&revision.Certifications,
+		&revision.UserID,
+		&revision.CreatedAt,
+	}
+}
+
+// ApplyTo sets the editable fields of movie to their values in the revision.
+func (revision *MovieRevision) ApplyTo(movie *Movie) {
+	movie.Title = revision.Title
+	movie.Year = revision.Year
+	movie.Runtime = revision.Runtime
+	movie.Genres = revision.Genres
+	movie.Tagline = revision.Tagline
+	movie.Synopsis = revision.Synopsis
+	movie.OriginalLanguage = revision.OriginalLanguage
+	movie.ExternalIDs = revision.ExternalIDs
+	movie.ReleaseDates = revision.ReleaseDates
+	movie.Certifications = revision.Certifications
+}
+
+// HideEditorFields clears who saved the revision, before it is shown to an anonymous
+// user.
+func (revision *MovieRevision) HideEditorFields() {
+	revision.UserID = nil
+}
+
+// FieldChange describes how a single movie field differs between two revisions. Added
+// and Removed are only set for list fields.
+type FieldChange struct {
+	From    any      `json:"from"`
+	To      any      `json:"to"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// Diff returns the fields whose values differ between the from and to revisions.
+func Diff(from, to *MovieRevision) map[string]FieldChange {
+	changes := make(map[string]FieldChange)
+	if from.Title != to.Title {
+		changes["title"] = FieldChange{From: from.Title, To: to.Title}
+	}
+	if from.Year != to.Year {
+		changes["year"] = FieldChange{From: from.Year, To: to.Year}
+	}
+	if from.Runtime != to.Runtime {
+		changes["runtime"] = FieldChange{From: from.formattedRuntime(), To: to.formattedRuntime()}
+	}
+	added, removed := difference(to.Genres, from.Genres), difference(from.Genres, to.Genres)
+	if !equalStrings(from.Genres, to.Genres) {
+		changes["genres"] = FieldChange{From: from.Genres, To: to.Genres, Added: added, Removed: removed}
+	}
+	if from.Tagline != to.Tagline {
+		changes["tagline"] = FieldChange{From: from.Tagline, To: to.Tagline}
+	}
+	if from.Synopsis != to.Synopsis {
+		changes["synopsis"] = FieldChange{From: from.Synopsis, To: to.Synopsis}
+	}
+	if from.OriginalLanguage != to.OriginalLanguage {
+		changes["original_language"] = FieldChange{From: from.OriginalLanguage, To: to.OriginalLanguage}
+	}
+	if !equalMaps(from.ExternalIDs, to.ExternalIDs) {
+		changes["external_ids"] = FieldChange{From: from.ExternalIDs, To: to.ExternalIDs}
+	}
+	if !equalMaps(from.ReleaseDates, to.ReleaseDates) {
+		changes["release_dates"] = FieldChange{From: from.ReleaseDates, To: to.ReleaseDates}
+	}
+	if !equalMaps(from.Certifications, to.Certifications) {
+		changes["certifications"] = FieldChange{From: from.Certifications, To: to.Certifications}
+	}
+	return changes
+}
+
+// equalMaps reports whether a and b hold the same entries. A nil map equals an empty
+// one.
+func equalMaps[M ~map[string]string](a, b M) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if other, ok := b[key]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// difference returns the values in a which aren't in b.
+func difference(a, b []string) []string {
+	seen := make(map[string]bool, len(b))
+	for _, value := range b {
+		seen[value] = true
+	}
+	var result []string
+	for _, value := range a {
+		if !seen[value] {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+type MovieRevisionModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+func insertRevision(ctx context.Context, tx *sql.Tx, movie *Movie, editorID int64) error {
+	query := `
+INSERT INTO movie_revisions (movie_id, version, title, year, runtime, genres,
+	tagline, synopsis, original_language, external_ids, release_dates, certifications, user_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`
+	args := []any{
+		movie.ID, movie.Version, movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres),
+		movie.Tagline, movie.Synopsis, movie.OriginalLanguage, movie.ExternalIDs, movie.ReleaseDates, movie.Certifications,
+		editorID,
+	}
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (m MovieRevisionModel) Get(ctx context.Context, movieID int64, version int32) (_ *MovieRevision, err error) {
+	if movieID < 1 || version < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+SELECT ` + revisionColumns + `
+FROM movie_revisions
+WHERE movie_id = $1 AND version = $2`
+	ctx, endSpan := startSpan(ctx, "MovieRevisionModel.Get")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
+	defer cancel()
+
+	var revision MovieRevision
+	err = m.DB.QueryRowContext(ctx, query, movieID, version).Scan(revision.scanFields()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &revision, nil
+}
+func (m MovieRevisionModel) GetAllForMovie(ctx context.Context, movieID int64, filters Filters) (_ []*MovieRevision, _ Metadata, err error) {
+	query := fmt.Sprintf(`SELECT count(*) OVER(), `+revisionColumns+`
+	FROM movie_revisions
+	WHERE movie_id = $1
+	ORDER BY %s %s
+	LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, endSpan := startSpan(ctx, "MovieRevisionModel.GetAllForMovie")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, movieID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	revisions := []*MovieRevision{}
+	totalRecords := 0
+	for rows.Next() {
+		var revision MovieRevision
+		err := rows.Scan(append([]any{&totalRecords}, revision.scanFields()...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		revisions = append(revisions, &revision)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return revisions, metadata, nil
+}
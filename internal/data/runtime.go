@@ -3,47 +3,174 @@ package data
 import (
 	"errors"
 	"fmt"
+	"math"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var ErrInvalidRuntimeFormat = errors.New("invalid rumtime format")
 
+// Runtime is the length of a movie in whole minutes.
 type Runtime int32
 
-func (r Runtime) MarshalJSON() ([]byte, error) {
-	jsonValue := fmt.Sprintf("%d mins", r)
+// RuntimeFormat names a JSON representation of a Runtime.
+type RuntimeFormat string
+
+const (
+	RuntimeFormatMins     RuntimeFormat = "mins"     // "102 mins", the default
+	RuntimeFormatMinutes  RuntimeFormat = "minutes"  // 102
+	RuntimeFormatHuman    RuntimeFormat = "human"    // "1h 42m"
+	RuntimeFormatISO8601  RuntimeFormat = "iso8601"  // "PT1H42M"
+	RuntimeFormatDuration RuntimeFormat = "duration" // "1h42m0s", as printed by time.Duration
+)
+
+var RuntimeFormats = []RuntimeFormat{RuntimeFormatMins, RuntimeFormatMinutes, RuntimeFormatHuman, RuntimeFormatISO8601, RuntimeFormatDuration}
+
+var (
+	minutesRX = regexp.MustCompile(`^(\d+)\s*(?:m|min|mins|minute|minutes)?$`)
+	humanRX   = regexp.MustCompile(`^(?:(\d+)\s*(?:h|hr|hrs|hour|hours))?\s*(?:(\d+)\s*(?:m|min|mins|minute|minutes))?$`)
+	iso8601RX = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+)
+
+// ParseRuntime reads a runtime written as a number of minutes ("102", "102 min",
+// "102 mins"), in hours and minutes ("1h 42m", "1 hour 42 minutes"), as an ISO 8601
+// duration ("PT1H42M") or as a Go duration string ("1h42m0s"). Durations must come to a
+// whole number of minutes.
+func ParseRuntime(s string) (Runtime, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return 0, ErrInvalidRuntimeFormat
+	}
+
+	if m := minutesRX.FindStringSubmatch(s); m != nil {
+		minutes, err := strconv.ParseInt(m[1], 10, 32)
+		if err != nil {
+			return 0, ErrInvalidRuntimeFormat
+		}
+		return Runtime(minutes), nil
+	}
+	if m := humanRX.FindStringSubmatch(s); m != nil && (m[1] != "" || m[2] != "") {
+		var parts [2]int64
+		for i, part := range m[1:] {
+			if part == "" {
+				continue
+			}
+			n, err := strconv.ParseInt(part, 10, 32)
+			if err != nil {
+				return 0, ErrInvalidRuntimeFormat
+			}
+			parts[i] = n
+		}
+		return runtimeFromSeconds((parts[0]*60 + parts[1]) * 60)
+	}
+	if m := iso8601RX.FindStringSubmatch(strings.ToUpper(s)); m != nil && s != "p" && !strings.HasSuffix(s, "t") {
+		var seconds int64
+		for i, unit := range []int64{24 * 60 * 60, 60 * 60, 60, 1} {
+			if m[i+1] == "" {
+				continue
+			}
+			n, err := strconv.ParseInt(m[i+1], 10, 64)
+			if err != nil || n > math.MaxInt32*60/unit {
+				return 0, ErrInvalidRuntimeFormat
+			}
+			seconds += n * unit
+		}
+		return runtimeFromSeconds(seconds)
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		if d%time.Second != 0 {
+			return 0, ErrInvalidRuntimeFormat
+		}
+		return runtimeFromSeconds(int64(d / time.Second))
+	}
+	return 0, ErrInvalidRuntimeFormat
+}
+
+func runtimeFromSeconds(seconds int64) (Runtime, error) {
+	if seconds%60 != 0 || seconds/60 > math.MaxInt32 {
+		return 0, ErrInvalidRuntimeFormat
+	}
+	return Runtime(seconds / 60), nil
+}
+
+// Format returns the runtime written in the given format. Numbers are returned without
+// quotes, so RuntimeFormatMinutes gives "102".
+func (r Runtime) Format(format RuntimeFormat) string {
+	switch format {
+	case RuntimeFormatMinutes:
+		return strconv.FormatInt(int64(r), 10)
+	case RuntimeFormatHuman:
+		switch {
+		case r < 60:
+			return fmt.Sprintf("%dm", r)
+		case r%60 == 0:
+			return fmt.Sprintf("%dh", r/60)
+		default:
+			return fmt.Sprintf("%dh %dm", r/60, r%60)
+		}
+	case RuntimeFormatISO8601:
+		switch {
+		case r < 60:
+			return fmt.Sprintf("PT%dM", r)
+		case r%60 == 0:
+			return fmt.Sprintf("PT%dH", r/60)
+		default:
+			return fmt.Sprintf("PT%dH%dM", r/60, r%60)
+		}
+	case RuntimeFormatDuration:
+		return (time.Duration(r) * time.Minute).String()
+	default:
+		return fmt.Sprintf("%d mins", r)
+	}
+}
 
-	quotedJSONValue := strconv.Quote(jsonValue)
+// MarshalJSONFormat encodes the runtime in the given format, as a number for
+// RuntimeFormatMinutes and as a string otherwise.
+func (r Runtime) MarshalJSONFormat(format RuntimeFormat) ([]byte, error) {
+	if format == RuntimeFormatMinutes {
+		return []byte(r.Format(format)), nil
+	}
+	return []byte(strconv.Quote(r.Format(format))), nil
+}
 
-	return []byte(quotedJSONValue), nil
+func (r Runtime) MarshalJSON() ([]byte, error) {
+	return r.MarshalJSONFormat(RuntimeFormatMins)
 }
+
+// UnmarshalJSON accepts a whole number of minutes or any string ParseRuntime
+// understands.
 func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
-	// We expect that the incoming JSON value will be a string in the format
-	// "<runtime> mins", and the first thing we need to do is remove the surrounding
-	// double-quotes from this string. If we can't unquote it, then we return the
-	// ErrInvalidRuntimeFormat error.
+	if string(jsonValue) == "null" {
+		return nil
+	}
+	if len(jsonValue) > 0 && jsonValue[0] != '"' {
+		n, err := strconv.ParseInt(string(jsonValue), 10, 32)
+		if err != nil {
+			return ErrInvalidRuntimeFormat
+		}
+		*r = Runtime(n)
+		return nil
+	}
 	unquotedJSONValue, err := strconv.Unquote(string(jsonValue))
 	if err != nil {
 		return ErrInvalidRuntimeFormat
 	}
-	// Split the string to isolate the part containing the number.
-	parts := strings.Split(unquotedJSONValue, " ")
-	// Sanity check the parts of the string to make sure it was in the expected format.
-	// If it isn't, we return the ErrInvalidRuntimeFormat error again.
-	if len(parts) != 2 || parts[1] != "mins" {
-		return ErrInvalidRuntimeFormat
-	}
-	// Otherwise, parse the string containing the number into an int32. Again, if this
-	// fails return the ErrInvalidRuntimeFormat error.
-	i, err := strconv.ParseInt(parts[0], 10, 32)
+	runtime, err := ParseRuntime(unquotedJSONValue)
 	if err != nil {
-		return ErrInvalidRuntimeFormat
+		return err
 	}
-	// Convert the int32 to a Runtime type and assign this to the receiver. Note that we
-	// use the * operator to deference the receiver (which is a pointer to a Runtime
-	// type) in order to set the underlying value of the pointer.
-	*r = Runtime(i)
+	*r = runtime
 	return nil
+}
+
+// FormattedRuntime is a runtime to be written as JSON in the given format.
+type FormattedRuntime struct {
+	Runtime Runtime
+	Format  RuntimeFormat
+}
 
+func (r FormattedRuntime) MarshalJSON() ([]byte, error) {
+	return r.Runtime.MarshalJSONFormat(r.Format)
 }
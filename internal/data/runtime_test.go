@@ -0,0 +1,245 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseRuntime(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Runtime
+		err   error
+	}{
+		{input: "102", want: 102},
+		{input: "0", want: 0},
+		{input: " 102 ", want: 102},
+		{input: "102m", want: 102},
+		{input: "102 min", want: 102},
+		{input: "102 mins", want: 102},
+		{input: "102 minutes", want: 102},
+		{input: "102 MINS", want: 102},
+		{input: "1 minute", want: 1},
+		{input: "1h 42m", want: 102},
+		{input: "1h42m", want: 102},
+		{input: "1 h 42 m", want: 102},
+		{input: "1 hour 42 minutes", want: 102},
+		{input: "2 hours", want: 120},
+		{input: "2h", want: 120},
+		{input: "1hr 5min", want: 65},
+		{input: "1 hrs 5 mins", want: 65},
+		{input: "PT1H42M", want: 102},
+		{input: "pt1h42m", want: 102},
+		{input: "PT102M", want: 102},
+		{input: "PT2H", want: 120},
+		{input: "PT6120S", want: 102},
+		{input: "PT1H41M60S", want: 102},
+		{input: "P1D", want: 1440},
+		{input: "P1DT1M", want: 1441},
+		{input: "1h42m0s", want: 102},
+		{input: "6120s", want: 102},
+		{input: "1.5h", want: 90},
+		{input: "90m0s", want: 90},
+		{input: "2147483647", want: 2147483647},
+		{input: "", err: ErrInvalidRuntimeFormat},
+		{input: "   ", err: ErrInvalidRuntimeFormat},
+		{input: "mins", err: ErrInvalidRuntimeFormat},
+		{input: "-5", err: ErrInvalidRuntimeFormat},
+		{input: "-5 mins", err: ErrInvalidRuntimeFormat},
+		{input: "-1h", err: ErrInvalidRuntimeFormat},
+		{input: "102.5", err: ErrInvalidRuntimeFormat},
+		{input: "102 secs", err: ErrInvalidRuntimeFormat},
+		{input: "1h 42", err: ErrInvalidRuntimeFormat},
+		{input: "h", err: ErrInvalidRuntimeFormat},
+		{input: "P", err: ErrInvalidRuntimeFormat},
+		{input: "PT", err: ErrInvalidRuntimeFormat},
+		{input: "P1DT", err: ErrInvalidRuntimeFormat},
+		{input: "PT1M30S", err: ErrInvalidRuntimeFormat},
+		{input: "PT1.5H", err: ErrInvalidRuntimeFormat},
+		{input: "1m30s", err: ErrInvalidRuntimeFormat},
+		{input: "1ms", err: ErrInvalidRuntimeFormat},
+		{input: "2147483648", err: ErrInvalidRuntimeFormat},
+		{input: "99999999999999999999 mins", err: ErrInvalidRuntimeFormat},
+		{input: "35791395h 8m", err: ErrInvalidRuntimeFormat},
+		{input: "ninety minutes", err: ErrInvalidRuntimeFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseRuntime(tt.input)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("ParseRuntime(%q) error = %v, want %v", tt.input, err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRuntime(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuntimeUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  Runtime
+		err   bool
+	}{
+		{name: "integer", input: `102`, want: 102},
+		{name: "zero", input: `0`, want: 0},
+		{name: "negative integer", input: `-5`, want: -5},
+		{name: "legacy string", input: `"102 mins"`, want: 102},
+		{name: "minutes string", input: `"102"`, want: 102},
+		{name: "human string", input: `"1h 42m"`, want: 102},
+		{name: "iso 8601 string", input: `"PT1H42M"`, want: 102},
+		{name: "go duration string", input: `"1h42m0s"`, want: 102},
+		{name: "null keeps value", input: `null`, want: 7},
+		{name: "fraction", input: `102.5`, err: true},
+		{name: "exponent", input: `1e2`, err: true},
+		{name: "overflow", input: `2147483648`, err: true},
+		{name: "boolean", input: `true`, err: true},
+		{name: "array", input: `[102]`, err: true},
+		{name: "object", input: `{"minutes":102}`, err: true},
+		{name: "empty string", input: `""`, err: true},
+		{name: "invalid string", input: `"a while"`, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var input struct {
+				Runtime Runtime `json:"runtime"`
+			}
+			input.Runtime = 7
+			err := json.Unmarshal([]byte(`{"runtime":`+tt.input+`}`), &input)
+			if (err != nil) != tt.err {
+				t.Fatalf("unmarshal %s: error = %v, want error %t", tt.input, err, tt.err)
+			}
+			if err == nil && input.Runtime != tt.want {
+				t.Errorf("unmarshal %s = %d, want %d", tt.input, input.Runtime, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuntimeFormat(t *testing.T) {
+	tests := []struct {
+		runtime Runtime
+		format  RuntimeFormat
+		want    string
+	}{
+		{102, RuntimeFormatMins, `"102 mins"`},
+		{102, "", `"102 mins"`},
+		{102, RuntimeFormatMinutes, `102`},
+		{102, RuntimeFormatHuman, `"1h 42m"`},
+		{120, RuntimeFormatHuman, `"2h"`},
+		{42, RuntimeFormatHuman, `"42m"`},
+		{0, RuntimeFormatHuman, `"0m"`},
+		{102, RuntimeFormatISO8601, `"PT1H42M"`},
+		{120, RuntimeFormatISO8601, `"PT2H"`},
+		{42, RuntimeFormatISO8601, `"PT42M"`},
+		{0, RuntimeFormatISO8601, `"PT0M"`},
+		{102, RuntimeFormatDuration, `"1h42m0s"`},
+		{0, RuntimeFormatDuration, `"0s"`},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format)+"/"+tt.want, func(t *testing.T) {
+			got, err := tt.runtime.MarshalJSONFormat(tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Runtime(%d).MarshalJSONFormat(%q) = %s, want %s", tt.runtime, tt.format, got, tt.want)
+			}
+		})
+	}
+}
+
+// Every format must read back as the runtime it was written from.
+func TestRuntimeRoundTrip(t *testing.T) {
+	for _, format := range RuntimeFormats {
+		for _, runtime := range []Runtime{0, 1, 59, 60, 61, 102, 1440, 100000} {
+			js, err := runtime.MarshalJSONFormat(format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got Runtime
+			err = json.Unmarshal(js, &got)
+			if err != nil {
+				t.Errorf("format %s: unmarshal %s: %v", format, js, err)
+				continue
+			}
+			if got != runtime {
+				t.Errorf("format %s: %s read back as %d, want %d", format, js, got, runtime)
+			}
+		}
+	}
+}
+
+func TestMarshalRuntimeFormat(t *testing.T) {
+	movie := &Movie{ID: 1, Title: "Moana", Runtime: 102, Genres: []string{"drama"}, Version: 1}
+	similar := &SimilarMovie{Movie: &Movie{ID: 2, Title: "Frozen", Runtime: 102}, Similarity: 0.5}
+	from := &MovieRevision{MovieID: 1, Version: 1, Runtime: 90}
+	to := &MovieRevision{MovieID: 1, Version: 2, Runtime: 102}
+
+	for _, format := range RuntimeFormats {
+		t.Run(string(format), func(t *testing.T) {
+			want, err := Runtime(102).MarshalJSONFormat(format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, value := range []interface{ SetRuntimeFormat(RuntimeFormat) }{movie, similar, from, to} {
+				value.SetRuntimeFormat(format)
+			}
+
+			tests := []struct {
+				name  string
+				value any
+				path  []string
+			}{
+				{name: "movie", value: movie, path: []string{"runtime"}},
+				{name: "similar movie", value: similar, path: []string{"runtime"}},
+				{name: "revision", value: to, path: []string{"runtime"}},
+				{name: "diff", value: Diff(from, to), path: []string{"runtime", "to"}},
+			}
+			for _, tt := range tests {
+				js, err := json.Marshal(tt.value)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var decoded map[string]any
+				err = json.Unmarshal(js, &decoded)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var got any = decoded
+				for _, key := range tt.path {
+					got = got.(map[string]any)[key]
+				}
+				gotJS, _ := json.Marshal(got)
+				if string(gotJS) != string(want) {
+					t.Errorf("%s: got runtime %s, want %s in %s", tt.name, gotJS, want, js)
+				}
+			}
+		})
+	}
+
+	js, err := json.Marshal(similar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]any
+	err = json.Unmarshal(js, &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded["similarity"] != 0.5 || decoded["title"] != "Frozen" {
+		t.Errorf("got %s, want the movie fields along with the similarity", js)
+	}
+
+	js, err = json.Marshal(&Movie{ID: 3, Title: "Untimed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(js), "runtime") {
+		t.Errorf("got %s, want the missing runtime left out", js)
+	}
+}
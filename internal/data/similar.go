@@ -0,0 +1,84 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/lib/pq"
+)
+
+// Weights of the components of the similarity score. They add up to 1, so scores range
+// from 0 to 1.
+const (
+	similarityGenreWeight   = 0.5
+	similarityYearWeight    = 0.2
+	similarityRuntimeWeight = 0.15
+	similarityTitleWeight   = 0.15
+)
+
+// SimilarMovie is a movie together with how similar it is to the movie it was found for.
+type SimilarMovie struct {
+	*Movie
+	Similarity float64 `json:"similarity"`
+}
+
+// MarshalJSON writes the fields of the movie alongside the similarity, rather than
+// leaving it to the promoted Movie.MarshalJSON.
+func (movie SimilarMovie) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		movieJSON
+		Similarity float64 `json:"similarity"`
+	}{movie.Movie.toJSON(), movie.Similarity})
+}
+
+// GetSimilar returns a page of the movies most similar to movie. Only movies sharing at
+// least one genre are considered, which lets PostgreSQL use the GIN index on genres.
+// They are ranked by a weighted sum of the Jaccard similarity of their genres, how close
+// their release years and runtimes are and the Jaccard similarity of their title words.
+func (m *MovieModel) GetSimilar(ctx context.Context, movie *Movie, filters Filters) (_ []*SimilarMovie, _ Metadata, err error) {
+	query := `
+SELECT count(*) OVER(), ` + movieColumns + `, similarity
+FROM (
+	SELECT *,
+		$5::float8 * array_jaccard(genres, $2)
+		+ $6::float8 / (1 + abs(year - $3) / 5.0)
+		+ $7::float8 / (1 + abs(runtime - $4) / 15.0)
+		+ $8::float8 * array_jaccard(title_tokens(title), title_tokens($9)) AS similarity
+	FROM movies
+	WHERE genres && $2 AND id <> $1 AND deleted_at IS NULL
+) AS candidates
+ORDER BY similarity DESC, id ASC
+LIMIT $10 OFFSET $11`
+	args := []any{
+		movie.ID, pq.Array(movie.Genres), movie.Year, movie.Runtime,
+		similarityGenreWeight, similarityYearWeight, similarityRuntimeWeight, similarityTitleWeight,
+		movie.Title, filters.limit(), filters.offset(),
+	}
+
+	ctx, endSpan := startSpan(ctx, "MovieModel.GetSimilar")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	movies := []*SimilarMovie{}
+	totalRecords := 0
+	for rows.Next() {
+		similar := SimilarMovie{Movie: &Movie{}}
+		dest := append([]any{&totalRecords}, similar.Movie.scanFields()...)
+		err := rows.Scan(append(dest, &similar.Similarity)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		movies = append(movies, &similar)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return movies, metadata, nil
+}
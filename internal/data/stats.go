@@ -0,0 +1,113 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+type GenreCount struct {
+	Genre string `json:"genre"`
+	Count int64  `json:"count"`
+}
+
+type DecadeCount struct {
+	Decade         int32   `json:"decade"`
+	Count          int64   `json:"count"`
+	AverageRuntime float64 `json:"average_runtime"`
+}
+
+// RuntimeBucket counts the movies with a runtime between From and To minutes inclusive.
+type RuntimeBucket struct {
+	From  int32 `json:"from"`
+	To    int32 `json:"to"`
+	Count int64 `json:"count"`
+}
+
+// WeekCount counts the movies added in the week starting on Week.
+type WeekCount struct {
+	Week  string `json:"week"`
+	Count int64  `json:"count"`
+}
+
+// MovieStats are aggregate statistics about the catalogue, as of RefreshedAt. Movies in
+// the trash are not counted.
+type MovieStats struct {
+	RefreshedAt      time.Time       `json:"refreshed_at"`
+	TotalMovies      int64           `json:"total_movies"`
+	TotalGenres      int64           `json:"total_genres"`
+	AverageRuntime   float64         `json:"average_runtime"`
+	ByGenre          []GenreCount    `json:"by_genre"`
+	ByDecade         []DecadeCount   `json:"by_decade"`
+	RuntimeHistogram []RuntimeBucket `json:"runtime_histogram"`
+	AddedPerWeek     []WeekCount     `json:"added_per_week"`
+}
+
+// jsonColumn scans a json or jsonb column into the value pointed to by dst. A NULL
+// leaves dst untouched.
+type jsonColumn struct {
+	dst any
+}
+
+func (c jsonColumn) Scan(src any) error {
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(src, c.dst)
+	case string:
+		return json.Unmarshal([]byte(src), c.dst)
+	default:
+		return errors.New("unsupported json value")
+	}
+}
+
+// StatsModel reads catalogue statistics from the movie_stats materialized view, which
+// is only as fresh as its last refresh.
+type StatsModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+func (m StatsModel) GetMovieStats(ctx context.Context) (_ *MovieStats, err error) {
+	query := `
+SELECT refreshed_at, total_movies, total_genres, average_runtime, by_genre, by_decade, runtime_histogram, added_per_week
+FROM movie_stats`
+	ctx, endSpan := startSpan(ctx, "StatsModel.GetMovieStats")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
+	defer cancel()
+
+	var stats MovieStats
+	err = m.DB.QueryRowContext(ctx, query).Scan(
+		&stats.RefreshedAt,
+		&stats.TotalMovies,
+		&stats.TotalGenres,
+		&stats.AverageRuntime,
+		jsonColumn{&stats.ByGenre},
+		jsonColumn{&stats.ByDecade},
+		jsonColumn{&stats.RuntimeHistogram},
+		jsonColumn{&stats.AddedPerWeek},
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &stats, nil
+}
+
+// RefreshMovieStats recomputes the movie_stats view without blocking readers.
+func (m StatsModel) RefreshMovieStats(ctx context.Context) (err error) {
+	ctx, endSpan := startSpan(ctx, "StatsModel.RefreshMovieStats")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Refresh)
+	defer cancel()
+	_, err = m.DB.ExecContext(ctx, `REFRESH MATERIALIZED VIEW CONCURRENTLY movie_stats`)
+	return err
+}
@@ -0,0 +1,31 @@
+package data
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("greenlight.darkhanomirbay/internal/data")
+
+// startSpan starts a span for a database query made by a model method, such as
+// "MovieModel.Get", as a child of the span in ctx. The returned function ends the span
+// and marks it as failed if *errp is not nil, so methods defer it on their named error
+// result:
+//
+//	ctx, endSpan := startSpan(ctx, "MovieModel.Get")
+//	defer endSpan(&err)
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, func(errp *error)) {
+	attrs = append(attrs, semconv.DBSystemPostgreSQL)
+	ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return ctx, func(errp *error) {
+		if err := *errp; err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
@@ -0,0 +1,38 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+func TestStartSpanRecordsError(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	query := func(name string, result error) (err error) {
+		_, endSpan := startSpan(context.Background(), name)
+		defer endSpan(&err)
+		return result
+	}
+	query("MovieModel.Get", nil)
+	query("MovieModel.Update", errors.New("connection refused"))
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d ended spans, want 2", len(spans))
+	}
+	if got := spans[0].Status().Code; got != codes.Unset {
+		t.Errorf("got status %v for a query that succeeded, want unset", got)
+	}
+	if got := spans[1].Status(); got.Code != codes.Error || got.Description != "connection refused" {
+		t.Errorf("got status %v for a failed query, want the error", got)
+	}
+	if events := spans[1].Events(); len(events) != 1 || events[0].Name != "exception" {
+		t.Errorf("got events %v for a failed query, want the recorded error", events)
+	}
+}
@@ -0,0 +1,176 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"greenlight.darkhanomirbay/internal/validator"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// LocaleRX matches BCP 47 tags made of a language, an optional script and an optional
+// region, in their canonical case, such as "fr", "pt-BR" or "zh-Hant-TW".
+var LocaleRX = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z][a-z]{3})?(-([A-Z]{2}|[0-9]{3}))?$`)
+
+// MovieTranslation is the title and synopsis of a movie in another language.
+type MovieTranslation struct {
+	MovieID   int64     `json:"movie_id"`
+	Locale    string    `json:"locale"`
+	Title     string    `json:"title"`
+	Synopsis  string    `json:"synopsis,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func ValidateTranslation(v *validator.Validator, translation *MovieTranslation) {
+	v.Check(validator.Matches(translation.Locale, LocaleRX), "locale", "must be a language tag such as en or pt-BR")
+	v.Check(translation.Title != "", "title", "must be provided")
+	v.Check(len(translation.Title) <= 500, "title", "must not be more than 500 bytes long")
+	v.Check(len(translation.Synopsis) <= 5000, "synopsis", "must not be more than 5000 bytes long")
+}
+
+type MovieTranslationModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+// Upsert creates or replaces the translation of the movie into its locale.
+func (m MovieTranslationModel) Upsert(ctx context.Context, translation *MovieTranslation) (err error) {
+	query := `
+INSERT INTO movie_translations (movie_id, locale, title, synopsis)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (movie_id, locale) DO UPDATE SET title = EXCLUDED.title, synopsis = EXCLUDED.synopsis, updated_at = NOW()
+RETURNING updated_at`
+	ctx, endSpan := startSpan(ctx, "MovieTranslationModel.Upsert")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
+	defer cancel()
+
+	args := []any{translation.MovieID, translation.Locale, translation.Title, translation.Synopsis}
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&translation.UpdatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		switch {
+		case errors.As(err, &pqErr) && pqErr.Code == "23503":
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m MovieTranslationModel) GetAllForMovie(ctx context.Context, movieID int64) (_ []*MovieTranslation, err error) {
+	query := `
+SELECT movie_id, locale, title, synopsis, updated_at
+FROM movie_translations
+WHERE movie_id = $1
+ORDER BY locale`
+	ctx, endSpan := startSpan(ctx, "MovieTranslationModel.GetAllForMovie")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	translations := []*MovieTranslation{}
+	for rows.Next() {
+		var translation MovieTranslation
+		err := rows.Scan(&translation.MovieID, &translation.Locale, &translation.Title, &translation.Synopsis, &translation.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		translations = append(translations, &translation)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return translations, nil
+}
+
+func (m MovieTranslationModel) Delete(ctx context.Context, movieID int64, locale string) (err error) {
+	query := `DELETE FROM movie_translations WHERE movie_id=$1 AND locale=$2`
+	ctx, endSpan := startSpan(ctx, "MovieTranslationModel.Delete")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, movieID, locale)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Localize replaces the titles of the movies with their translation into the first of
+// the locales that one exists for. locales are matched case-insensitively and in order
+// of preference. Movies without a matching translation keep their original title.
+func (m MovieTranslationModel) Localize(ctx context.Context, movies []*Movie, locales []string) (err error) {
+	if len(movies) == 0 || len(locales) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+	}
+	preferred := make([]string, len(locales))
+	for i, locale := range locales {
+		preferred[i] = strings.ToLower(locale)
+	}
+
+	query := `
+SELECT DISTINCT ON (movie_id) movie_id, locale, title, synopsis
+FROM movie_translations
+WHERE movie_id = ANY($1) AND lower(locale) = ANY($2)
+ORDER BY movie_id, array_position($2::text[], lower(locale))`
+	ctx, endSpan := startSpan(ctx, "MovieTranslationModel.Localize")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids), pq.Array(preferred))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	translations := make(map[int64]MovieTranslation, len(movies))
+	for rows.Next() {
+		var translation MovieTranslation
+		err := rows.Scan(&translation.MovieID, &translation.Locale, &translation.Title, &translation.Synopsis)
+		if err != nil {
+			return err
+		}
+		translations[translation.MovieID] = translation
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, movie := range movies {
+		translation, ok := translations[movie.ID]
+		if !ok {
+			continue
+		}
+		movie.OriginalTitle = movie.Title
+		movie.Title = translation.Title
+		movie.Locale = translation.Locale
+		if translation.Synopsis != "" {
+			movie.Synopsis = translation.Synopsis
+		}
+	}
+	return nil
+}
@@ -33,17 +33,20 @@ type password struct {
 	hash      []byte
 }
 type UserModel struct {
-	DB *sql.DB
+	DB       *sql.DB
+	Timeouts Timeouts
 }
 
-func (m UserModel) Insert(user *User) error {
+func (m UserModel) Insert(ctx context.Context, user *User) (err error) {
 	query := `INSERT INTO users(name,email,password_hash,activated) VALUES ($1,$2,$3,$4) RETURNING id,created_at,version`
 
 	args := []any{user.Name, user.Email, user.Password.hash, user.Activated}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, endSpan := startSpan(ctx, "UserModel.Insert")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
 	defer cancel()
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
 	if err != nil {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
@@ -54,13 +57,15 @@ func (m UserModel) Insert(user *User) error {
 	}
 	return nil
 }
-func (m UserModel) GetByEmail(email string) (*User, error) {
+func (m UserModel) GetByEmail(ctx context.Context, email string) (_ *User, err error) {
 	query := `SELECT id, created_at, name, email, password_hash, activated, version
 FROM users WHERE email=$1`
 	var user User
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, endSpan := startSpan(ctx, "UserModel.GetByEmail")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
 	defer cancel()
-	err := m.DB.QueryRowContext(ctx, query, email).Scan(
+	err = m.DB.QueryRowContext(ctx, query, email).Scan(
 		&user.ID,
 		&user.CreatedAt,
 		&user.Name,
@@ -79,7 +84,7 @@ FROM users WHERE email=$1`
 	}
 	return &user, nil
 }
-func (m UserModel) Update(user *User) error {
+func (m UserModel) Update(ctx context.Context, user *User) (err error) {
 	query := `UPDATE users SET name=$1,email=$2,password_hash=$3,activated=$4,version=version+1 WHERE id=$5 AND version=$6 RETURNING version`
 	args := []any{
 		user.Name,
@@ -90,9 +95,11 @@ func (m UserModel) Update(user *User) error {
 		user.Version,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, endSpan := startSpan(ctx, "UserModel.Update")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
 	defer cancel()
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
 	if err != nil {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
@@ -106,7 +113,7 @@ func (m UserModel) Update(user *User) error {
 	}
 	return nil
 }
-func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
+func (m UserModel) GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (_ *User, err error) {
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 
 	query := `SELECT users.id,users.created_at,users.name,users.email,users.password_hash,users.activated,users.version	
@@ -115,9 +122,11 @@ FROM users INNER JOIN tokens ON users.id=tokens.user_id WHERE tokens.hash=$1 AND
 	args := []any{tokenHash[:], tokenScope, time.Now()}
 
 	var user User
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, endSpan := startSpan(ctx, "UserModel.GetForToken")
+	defer endSpan(&err)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Query)
 	defer cancel()
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID,
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID,
 		&user.CreatedAt,
 		&user.Name,
 		&user.Email,
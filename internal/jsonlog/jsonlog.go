@@ -1,11 +1,16 @@
 package jsonlog
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"go.opentelemetry.io/otel/trace"
 	"io"
 	"os"
 	"runtime/debug"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -31,20 +36,44 @@ func (l Level) String() string {
 	}
 }
 
+// ParseLevel returns the level named by s, which is info, error, fatal or off in any case.
+func ParseLevel(s string) (Level, error) {
+	for level := LevelInfo; level < LevelOff; level++ {
+		if strings.EqualFold(s, level.String()) {
+			return level, nil
+		}
+	}
+	if strings.EqualFold(s, "off") {
+		return LevelOff, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", s)
+}
+
 type Logger struct {
-	out      io.Writer
-	minLevel Level
+	out io.Writer
+	// minLevel is atomic so that the level can be changed while the logger is in use.
+	minLevel atomic.Int32
 	mu       sync.Mutex
 }
 
 func New(out io.Writer, minLevel Level) *Logger {
-	return &Logger{
-		out:      out,
-		minLevel: minLevel,
-	}
+	l := &Logger{out: out}
+	l.SetLevel(minLevel)
+	return l
+}
+
+// SetLevel changes the minimum level of the entries that are written.
+func (l *Logger) SetLevel(minLevel Level) {
+	l.minLevel.Store(int32(minLevel))
 }
-func (l *Logger) print(level Level, message string, properties map[string]string) (int, error) {
-	if level < l.minLevel {
+
+// Level returns the minimum level of the entries that are written.
+func (l *Logger) Level() Level {
+	return Level(l.minLevel.Load())
+}
+
+func (l *Logger) print(level Level, message string, properties map[string]string, span trace.SpanContext) (int, error) {
+	if level < l.Level() {
 		return 0, nil
 	}
 	aux := struct {
@@ -52,6 +81,8 @@ func (l *Logger) print(level Level, message string, properties map[string]string
 		Time       string            `json:"time"`
 		Message    string            `json:"message"`
 		Properties map[string]string `json:"properties,omitempty"`
+		TraceID    string            `json:"trace_id,omitempty"`
+		SpanID     string            `json:"span_id,omitempty"`
 		Trace      string            `json:"trace,omitempty"`
 	}{
 		Level:      level.String(),
@@ -59,6 +90,10 @@ func (l *Logger) print(level Level, message string, properties map[string]string
 		Message:    message,
 		Properties: properties,
 	}
+	if span.IsValid() {
+		aux.TraceID = span.TraceID().String()
+		aux.SpanID = span.SpanID().String()
+	}
 	if level >= LevelError {
 		aux.Trace = string(debug.Stack())
 	}
@@ -73,16 +108,27 @@ func (l *Logger) print(level Level, message string, properties map[string]string
 	return l.out.Write(append(line, '\n'))
 }
 func (l *Logger) PrintInfo(message string, properties map[string]string) {
-	l.print(LevelInfo, message, properties)
+	l.print(LevelInfo, message, properties, trace.SpanContext{})
 }
 func (l *Logger) PrintError(error error, properties map[string]string) {
-	l.print(LevelError, error.Error(), properties)
+	l.print(LevelError, error.Error(), properties, trace.SpanContext{})
+}
+
+// PrintInfoContext is PrintInfo for messages about the work traced in ctx. The entry
+// carries the trace and span IDs, so it can be found from the trace and vice versa.
+func (l *Logger) PrintInfoContext(ctx context.Context, message string, properties map[string]string) {
+	l.print(LevelInfo, message, properties, trace.SpanContextFromContext(ctx))
+}
+
+// PrintErrorContext is PrintError with the trace and span IDs of the span in ctx.
+func (l *Logger) PrintErrorContext(ctx context.Context, error error, properties map[string]string) {
+	l.print(LevelError, error.Error(), properties, trace.SpanContextFromContext(ctx))
 }
 func (l *Logger) PrintFatal(error error, properties map[string]string) {
-	l.print(LevelFatal, error.Error(), properties)
+	l.print(LevelFatal, error.Error(), properties, trace.SpanContext{})
 	os.Exit(1)
 
 }
 func (l *Logger) Write(message []byte) (n int, err error) {
-	return l.print(LevelError, string(message), nil)
+	return l.print(LevelError, string(message), nil, trace.SpanContext{})
 }
@@ -2,15 +2,23 @@ package mailer
 
 import (
 	"bytes"
+	"context"
 	"embed"
 	"github.com/go-mail/mail/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"html/template"
+	"net"
+	"strconv"
 	"time"
 )
 
 //go:embed "templates"
 var templateFS embed.FS
 
+var tracer = otel.Tracer("greenlight.darkhanomirbay/internal/mailer")
+
 type Mailer struct {
 	dialer *mail.Dialer
 	sender string
@@ -24,7 +32,32 @@ func New(host string, port int, username, password, sender string) Mailer {
 		dialer: dialer,
 		sender: sender}
 }
-func (m Mailer) Send(recipient, templateFile string, data any) error {
+
+// Ping checks that the SMTP server accepts connections, without logging in or sending
+// anything.
+func (m Mailer) Ping() error {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(m.dialer.Host, strconv.Itoa(m.dialer.Port)), m.dialer.Timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// Send renders the email template and sends it to the recipient, recording the attempt
+// as a span that is a child of the span in ctx.
+func (m Mailer) Send(ctx context.Context, recipient, templateFile string, data any) error {
+	_, span := tracer.Start(ctx, "Mailer.Send")
+	defer span.End()
+	span.SetAttributes(attribute.String("email.template", templateFile))
+
+	err := m.send(recipient, templateFile, data)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+func (m Mailer) send(recipient, templateFile string, data any) error {
 	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
 	if err != nil {
 		return err
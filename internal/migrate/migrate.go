@@ -0,0 +1,288 @@
+// Package migrate applies and reverts the SQL migrations of the database schema.
+//
+// The current version is kept in the schema_migrations table in the format used by the
+// golang-migrate CLI, so databases migrated with it carry on where it left off.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+var (
+	ErrDirty          = errors.New("database is dirty")
+	ErrUnknownVersion = errors.New("unknown migration version")
+)
+
+// lockKey names the PostgreSQL advisory lock that keeps instances from migrating the
+// same database at once.
+const lockKey = "greenlight.darkhanomirbay/migrations"
+
+// fileRX matches migration file names such as 000001_create_movies_table.up.sql.
+var fileRX = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration is a numbered change to the schema, with the SQL that applies it and the
+// SQL that reverts it.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status reports whether a migration has been applied.
+type Status struct {
+	Migration
+	Applied bool
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New reads the migrations in the root of fsys. Every version must have both an up and
+// a down file.
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		matches := fileRX.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			continue
+		}
+		version, err := strconv.Atoi(matches[1])
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("%s: invalid version", entry.Name())
+		}
+		contents, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != matches[2] {
+			return nil, fmt.Errorf("%s: version %d is already used by %s", entry.Name(), version, migration.Name)
+		}
+		if matches[3] == "up" {
+			migration.Up = string(contents)
+		} else {
+			migration.Down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		switch {
+		case migration.Up == "":
+			return nil, fmt.Errorf("migration %d_%s has no up file", migration.Version, migration.Name)
+		case migration.Down == "":
+			return nil, fmt.Errorf("migration %d_%s has no down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrations returns every known migration in version order.
+func (m *Migrator) Migrations() []Migration {
+	return append([]Migration{}, m.migrations...)
+}
+
+// Latest returns the version of the last migration, or 0 if there are none.
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version returns the version the database is at, 0 if no migration has been applied,
+// and whether a migration failed half way through, leaving the database dirty.
+func (m *Migrator) Version(ctx context.Context) (version int, dirty bool, err error) {
+	err = ensureTable(ctx, m.db)
+	if err != nil {
+		return 0, false, err
+	}
+	return readVersion(ctx, m.db)
+}
+
+// Status returns every known migration with whether it has been applied, along with
+// the version of the database.
+func (m *Migrator) Status(ctx context.Context) ([]Status, int, bool, error) {
+	version, dirty, err := m.Version(ctx)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	statuses := make([]Status, len(m.migrations))
+	for i, migration := range m.migrations {
+		statuses[i] = Status{Migration: migration, Applied: migration.Version <= version}
+	}
+	return statuses, version, dirty, nil
+}
+
+// Up applies every pending migration and returns how many it applied.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	return m.Goto(ctx, m.Latest())
+}
+
+// Down reverts the last steps applied migrations, or all of them if fewer have been
+// applied, and returns how many it reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	return m.migrate(ctx, func(current int) int {
+		target := 0
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			if m.migrations[i].Version <= current {
+				if steps == 0 {
+					target = m.migrations[i].Version
+					break
+				}
+				steps--
+			}
+		}
+		return target
+	})
+}
+
+// Goto applies or reverts migrations until the database is at version, which must be 0
+// or the version of a known migration, and returns how many migrations it ran.
+func (m *Migrator) Goto(ctx context.Context, version int) (int, error) {
+	if version != 0 && m.index(version) < 0 {
+		return 0, fmt.Errorf("%w %d", ErrUnknownVersion, version)
+	}
+	return m.migrate(ctx, func(int) int { return version })
+}
+
+func (m *Migrator) index(version int) int {
+	for i, migration := range m.migrations {
+		if migration.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// migrate moves the database from its current version to the one returned by target.
+// It holds an advisory lock throughout, so an instance that starts while another is
+// migrating waits for it and then finds nothing left to do. Each migration runs in a
+// transaction of its own together with the version update.
+func (m *Migrator) migrate(ctx context.Context, target func(current int) int) (int, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock(hashtext($1))`, lockKey)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock(hashtext($1))`, lockKey)
+
+	err = ensureTable(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	current, dirty, err := readVersion(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return 0, fmt.Errorf("%w at version %d: repair the schema by hand, then clear the dirty flag in schema_migrations", ErrDirty, current)
+	}
+	if current != 0 && m.index(current) < 0 {
+		return 0, fmt.Errorf("database is at version %d: %w", current, ErrUnknownVersion)
+	}
+	version := target(current)
+
+	ran := 0
+	for _, migration := range m.migrations {
+		if migration.Version > current && migration.Version <= version {
+			err = apply(ctx, conn, migration.Up, migration.Version)
+			if err != nil {
+				return ran, fmt.Errorf("applying migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			ran++
+		}
+	}
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if migration.Version <= current && migration.Version > version {
+			previous := 0
+			if i > 0 {
+				previous = m.migrations[i-1].Version
+			}
+			err = apply(ctx, conn, migration.Down, previous)
+			if err != nil {
+				return ran, fmt.Errorf("reverting migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			ran++
+		}
+	}
+	return ran, nil
+}
+
+type execQueryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func ensureTable(ctx context.Context, db execQueryer) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL)`)
+	return err
+}
+
+func readVersion(ctx context.Context, db execQueryer) (version int, dirty bool, err error) {
+	err = db.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	return version, dirty, err
+}
+
+// apply runs the SQL of a migration and records version as the current one.
+func apply(ctx context.Context, conn *sql.Conn, query string, version int) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations`)
+	if err != nil {
+		return err
+	}
+	if version > 0 {
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, false)`, version)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,101 @@
+package migrate
+
+import (
+	"greenlight.darkhanomirbay/migrations"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadEmbedded(t *testing.T) {
+	loaded, err := load(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) == 0 {
+		t.Fatal("no migrations were embedded")
+	}
+	for i, migration := range loaded {
+		if migration.Version != i+1 {
+			t.Errorf("migration %d_%s: want version %d, as versions must have no gaps", migration.Version, migration.Name, i+1)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	file := func(contents string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(contents)}
+	}
+	tests := []struct {
+		name     string
+		fsys     fstest.MapFS
+		versions []int
+		err      string
+	}{
+		{
+			name: "sorted by version",
+			fsys: fstest.MapFS{
+				"000010_b.up.sql":   file("B"),
+				"000010_b.down.sql": file("-B"),
+				"000002_a.up.sql":   file("A"),
+				"000002_a.down.sql": file("-A"),
+				"README.md":         file("not a migration"),
+			},
+			versions: []int{2, 10},
+		},
+		{
+			name:     "empty",
+			fsys:     fstest.MapFS{},
+			versions: []int{},
+		},
+		{
+			name: "missing down",
+			fsys: fstest.MapFS{"000001_a.up.sql": file("A")},
+			err:  "has no down file",
+		},
+		{
+			name: "missing up",
+			fsys: fstest.MapFS{"000001_a.down.sql": file("-A")},
+			err:  "has no up file",
+		},
+		{
+			name: "version used twice",
+			fsys: fstest.MapFS{
+				"000001_a.up.sql":   file("A"),
+				"000001_a.down.sql": file("-A"),
+				"000001_b.up.sql":   file("B"),
+			},
+			err: "is already used by",
+		},
+		{
+			name: "version zero",
+			fsys: fstest.MapFS{"000000_a.up.sql": file("A")},
+			err:  "invalid version",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loaded, err := load(tt.fsys)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			versions := []int{}
+			for _, migration := range loaded {
+				versions = append(versions, migration.Version)
+				if migration.Up == "" || migration.Down == "" {
+					t.Errorf("migration %d is missing its SQL", migration.Version)
+				}
+			}
+			if !reflect.DeepEqual(versions, tt.versions) {
+				t.Errorf("got versions %v, want %v", versions, tt.versions)
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	MergePatchMediaType = "application/merge-patch+json"
+	JSONPatchMediaType  = "application/json-patch+json"
+)
+
+var (
+	ErrInvalidPointer = errors.New("invalid JSON pointer")
+	ErrPathNotFound   = errors.New("path does not exist")
+	ErrTestFailed     = errors.New("test operation failed")
+)
+
+// Operation is a single RFC 6902 JSON Patch operation. Value is kept raw so that an
+// explicit null can be told apart from a missing value.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Merge applies an RFC 7396 JSON Merge Patch to target and returns the result. Both
+// values are expected in the generic form produced by json.Unmarshal into an any.
+func Merge(target, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = make(map[string]any)
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = Merge(targetObject[key], value)
+	}
+	return targetObject
+}
+
+// Apply applies the RFC 6902 JSON Patch operations to doc in order. Processing stops at
+// the first failing operation and the error reports its index.
+func Apply(doc any, ops []Operation) (any, error) {
+	for i, op := range ops {
+		var err error
+		doc, err = applyOperation(doc, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return doc, nil
+}
+
+func applyOperation(doc any, op Operation) (any, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, errors.New("missing value")
+		}
+		var value any
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, err
+		}
+		switch op.Op {
+		case "add":
+			return add(doc, path, value)
+		case "replace":
+			return replace(doc, path, value)
+		default:
+			current, err := get(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(current, value) {
+				return nil, ErrTestFailed
+			}
+			return doc, nil
+		}
+	case "remove":
+		doc, _, err := remove(doc, path)
+		return doc, err
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "copy" {
+			return add(doc, path, deepCopy(value))
+		}
+		if strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, errors.New("cannot move a value into one of its children")
+		}
+		doc, _, err = remove(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	default:
+		return nil, fmt.Errorf("unsupported operation %q", op.Op)
+	}
+}
+
+// parsePointer splits an RFC 6901 JSON pointer into its unescaped reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, ErrInvalidPointer
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(tokens[i], "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func get(doc any, path []string) (any, error) {
+	for _, token := range path {
+		var err error
+		doc, err = child(doc, token)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+func add(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return update(doc, path, func(node any, token string) (any, error) {
+		switch node := node.(type) {
+		case map[string]any:
+			node[token] = value
+			return node, nil
+		case []any:
+			index := len(node)
+			if token != "-" {
+				var err error
+				index, err = arrayIndex(token, len(node)+1)
+				if err != nil {
+					return nil, err
+				}
+			}
+			result := make([]any, 0, len(node)+1)
+			result = append(result, node[:index]...)
+			result = append(result, value)
+			return append(result, node[index:]...), nil
+		default:
+			return nil, ErrPathNotFound
+		}
+	})
+}
+
+func replace(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return update(doc, path, func(node any, token string) (any, error) {
+		if _, err := child(node, token); err != nil {
+			return nil, err
+		}
+		return set(node, token, value)
+	})
+}
+
+func remove(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, nil, errors.New("cannot remove the whole document")
+	}
+	var removed any
+	doc, err := update(doc, path, func(node any, token string) (any, error) {
+		var err error
+		removed, err = child(node, token)
+		if err != nil {
+			return nil, err
+		}
+		switch node := node.(type) {
+		case map[string]any:
+			delete(node, token)
+			return node, nil
+		default:
+			list := node.([]any)
+			index, _ := arrayIndex(token, len(list))
+			result := make([]any, 0, len(list)-1)
+			result = append(result, list[:index]...)
+			return append(result, list[index+1:]...), nil
+		}
+	})
+	return doc, removed, err
+}
+
+// update walks down to the parent of the last token in path, lets fn produce the new
+// parent value and writes it back up the tree. Arrays have to be reassigned in their
+// own parent because fn may return a slice with a different length.
+func update(doc any, path []string, fn func(node any, token string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+	next, err := child(doc, path[0])
+	if err != nil {
+		return nil, err
+	}
+	next, err = update(next, path[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+	return set(doc, path[0], next)
+}
+
+func child(node any, token string) (any, error) {
+	switch node := node.(type) {
+	case map[string]any:
+		value, ok := node[token]
+		if !ok {
+			return nil, ErrPathNotFound
+		}
+		return value, nil
+	case []any:
+		index, err := arrayIndex(token, len(node))
+		if err != nil {
+			return nil, err
+		}
+		return node[index], nil
+	default:
+		return nil, ErrPathNotFound
+	}
+}
+
+func set(node any, token string, value any) (any, error) {
+	switch node := node.(type) {
+	case map[string]any:
+		node[token] = value
+		return node, nil
+	case []any:
+		index, err := arrayIndex(token, len(node))
+		if err != nil {
+			return nil, err
+		}
+		node[index] = value
+		return node, nil
+	default:
+		return nil, ErrPathNotFound
+	}
+}
+
+// arrayIndex parses an array reference token, which must be a non-negative integer
+// without leading zeros and smaller than limit.
+func arrayIndex(token string, limit int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, ErrInvalidPointer
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 {
+		return 0, ErrInvalidPointer
+	}
+	if index >= limit {
+		return 0, ErrPathNotFound
+	}
+	return index, nil
+}
+
+func deepCopy(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(value))
+		for key, v := range value {
+			result[key] = deepCopy(v)
+		}
+		return result
+	case []any:
+		result := make([]any, len(value))
+		for i, v := range value {
+			result[i] = deepCopy(v)
+		}
+		return result
+	default:
+		return value
+	}
+}
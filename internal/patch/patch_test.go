@@ -0,0 +1,317 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// decode unmarshals a JSON literal of a test case.
+func decode(t *testing.T, js string) any {
+	t.Helper()
+	var value any
+	err := json.Unmarshal([]byte(js), &value)
+	if err != nil {
+		t.Fatalf("decoding %s: %s", js, err)
+	}
+	return value
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		ops  string
+		want string
+		err  error
+	}{
+		{
+			name: "add a member",
+			doc:  `{"title":"Moana"}`,
+			ops:  `[{"op":"add","path":"/year","value":2016}]`,
+			want: `{"title":"Moana","year":2016}`,
+		},
+		{
+			name: "add replaces an existing member",
+			doc:  `{"year":2015}`,
+			ops:  `[{"op":"add","path":"/year","value":2016}]`,
+			want: `{"year":2016}`,
+		},
+		{
+			name: "add inserts into an array",
+			doc:  `{"genres":["animation","family"]}`,
+			ops:  `[{"op":"add","path":"/genres/1","value":"adventure"}]`,
+			want: `{"genres":["animation","adventure","family"]}`,
+		},
+		{
+			name: "add at the end of an array by index",
+			doc:  `{"genres":["animation"]}`,
+			ops:  `[{"op":"add","path":"/genres/1","value":"family"}]`,
+			want: `{"genres":["animation","family"]}`,
+		},
+		{
+			name: "add appends with -",
+			doc:  `{"genres":["animation"]}`,
+			ops:  `[{"op":"add","path":"/genres/-","value":"family"}]`,
+			want: `{"genres":["animation","family"]}`,
+		},
+		{
+			name: "add an explicit null",
+			doc:  `{}`,
+			ops:  `[{"op":"add","path":"/tagline","value":null}]`,
+			want: `{"tagline":null}`,
+		},
+		{
+			name: "add the whole document",
+			doc:  `{"title":"Moana"}`,
+			ops:  `[{"op":"add","path":"","value":{"title":"Frozen"}}]`,
+			want: `{"title":"Frozen"}`,
+		},
+		{
+			name: "add past the end of an array",
+			doc:  `{"genres":["animation"]}`,
+			ops:  `[{"op":"add","path":"/genres/2","value":"family"}]`,
+			err:  ErrPathNotFound,
+		},
+		{
+			name: "add below a missing member",
+			doc:  `{}`,
+			ops:  `[{"op":"add","path":"/external_ids/imdb","value":"tt3521164"}]`,
+			err:  ErrPathNotFound,
+		},
+		{
+			name: "add with a leading zero index",
+			doc:  `{"genres":["animation","family"]}`,
+			ops:  `[{"op":"add","path":"/genres/01","value":"adventure"}]`,
+			err:  ErrInvalidPointer,
+		},
+		{
+			name: "remove a member",
+			doc:  `{"title":"Moana","tagline":"The ocean is calling."}`,
+			ops:  `[{"op":"remove","path":"/tagline"}]`,
+			want: `{"title":"Moana"}`,
+		},
+		{
+			name: "remove an array element",
+			doc:  `{"genres":["animation","adventure","family"]}`,
+			ops:  `[{"op":"remove","path":"/genres/1"}]`,
+			want: `{"genres":["animation","family"]}`,
+		},
+		{
+			name: "remove a missing member",
+			doc:  `{"title":"Moana"}`,
+			ops:  `[{"op":"remove","path":"/tagline"}]`,
+			err:  ErrPathNotFound,
+		},
+		{
+			name: "remove out of range",
+			doc:  `{"genres":["animation"]}`,
+			ops:  `[{"op":"remove","path":"/genres/1"}]`,
+			err:  ErrPathNotFound,
+		},
+		{
+			name: "remove with -",
+			doc:  `{"genres":["animation"]}`,
+			ops:  `[{"op":"remove","path":"/genres/-"}]`,
+			err:  ErrInvalidPointer,
+		},
+		{
+			name: "replace a member",
+			doc:  `{"runtime":107}`,
+			ops:  `[{"op":"replace","path":"/runtime","value":102}]`,
+			want: `{"runtime":102}`,
+		},
+		{
+			name: "replace an array element",
+			doc:  `{"genres":["animation","family"]}`,
+			ops:  `[{"op":"replace","path":"/genres/0","value":"musical"}]`,
+			want: `{"genres":["musical","family"]}`,
+		},
+		{
+			name: "replace a missing member",
+			doc:  `{}`,
+			ops:  `[{"op":"replace","path":"/runtime","value":102}]`,
+			err:  ErrPathNotFound,
+		},
+		{
+			name: "replace out of range",
+			doc:  `{"genres":["animation"]}`,
+			ops:  `[{"op":"replace","path":"/genres/1","value":"family"}]`,
+			err:  ErrPathNotFound,
+		},
+		{
+			name: "move a member",
+			doc:  `{"title":"Moana","original_title":"Vaiana"}`,
+			ops:  `[{"op":"move","from":"/original_title","path":"/title"}]`,
+			want: `{"title":"Vaiana"}`,
+		},
+		{
+			name: "move within an array",
+			doc:  `{"genres":["animation","adventure","family"]}`,
+			ops:  `[{"op":"move","from":"/genres/0","path":"/genres/-"}]`,
+			want: `{"genres":["adventure","family","animation"]}`,
+		},
+		{
+			name: "move into a child",
+			doc:  `{"external_ids":{"imdb":"tt3521164"}}`,
+			ops:  `[{"op":"move","from":"/external_ids","path":"/external_ids/old"}]`,
+			err:  errors.New("cannot move a value into one of its children"),
+		},
+		{
+			name: "move a missing member",
+			doc:  `{}`,
+			ops:  `[{"op":"move","from":"/tagline","path":"/synopsis"}]`,
+			err:  ErrPathNotFound,
+		},
+		{
+			name: "copy a member",
+			doc:  `{"release_dates":{"US":"2016-11-23"}}`,
+			ops:  `[{"op":"copy","from":"/release_dates","path":"/premiere"}]`,
+			want: `{"release_dates":{"US":"2016-11-23"},"premiere":{"US":"2016-11-23"}}`,
+		},
+		{
+			name: "copy is deep",
+			doc:  `{"release_dates":{"US":"2016-11-23"}}`,
+			ops: `[{"op":"copy","from":"/release_dates","path":"/premiere"},
+				{"op":"replace","path":"/premiere/US","value":"2016-11-14"}]`,
+			want: `{"release_dates":{"US":"2016-11-23"},"premiere":{"US":"2016-11-14"}}`,
+		},
+		{
+			name: "copy out of range",
+			doc:  `{"genres":["animation"]}`,
+			ops:  `[{"op":"copy","from":"/genres/1","path":"/genres/-"}]`,
+			err:  ErrPathNotFound,
+		},
+		{
+			name: "test passes",
+			doc:  `{"genres":["animation","family"],"version":3}`,
+			ops: `[{"op":"test","path":"/version","value":3},
+				{"op":"test","path":"/genres","value":["animation","family"]},
+				{"op":"replace","path":"/version","value":4}]`,
+			want: `{"genres":["animation","family"],"version":4}`,
+		},
+		{
+			name: "test fails",
+			doc:  `{"version":3}`,
+			ops: `[{"op":"test","path":"/version","value":2},
+				{"op":"replace","path":"/version","value":4}]`,
+			err: ErrTestFailed,
+		},
+		{
+			name: "test a missing member",
+			doc:  `{}`,
+			ops:  `[{"op":"test","path":"/version","value":3}]`,
+			err:  ErrPathNotFound,
+		},
+		{
+			name: "escaped tokens",
+			doc:  `{"a/b":1,"c~d":2,"e~1f":3}`,
+			ops: `[{"op":"replace","path":"/a~1b","value":10},
+				{"op":"replace","path":"/c~0d","value":20},
+				{"op":"remove","path":"/e~01f"}]`,
+			want: `{"a/b":10,"c~d":20}`,
+		},
+		{
+			name: "pointer without a leading slash",
+			doc:  `{"title":"Moana"}`,
+			ops:  `[{"op":"replace","path":"title","value":"Frozen"}]`,
+			err:  ErrInvalidPointer,
+		},
+		{
+			name: "missing value",
+			doc:  `{"title":"Moana"}`,
+			ops:  `[{"op":"replace","path":"/title"}]`,
+			err:  errors.New("missing value"),
+		},
+		{
+			name: "unsupported operation",
+			doc:  `{"title":"Moana"}`,
+			ops:  `[{"op":"rename","path":"/title"}]`,
+			err:  errors.New(`unsupported operation "rename"`),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ops []Operation
+			err := json.Unmarshal([]byte(tt.ops), &ops)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Apply(decode(t, tt.doc), ops)
+			if tt.err != nil {
+				// Errors without a sentinel are compared by their message.
+				if err == nil || (!errors.Is(err, tt.err) && errors.Unwrap(err).Error() != tt.err.Error()) {
+					t.Fatalf("got error %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := decode(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		patch  string
+		want   string
+	}{
+		{
+			name:   "replace and add members",
+			target: `{"title":"Moana","year":2015}`,
+			patch:  `{"year":2016,"runtime":107}`,
+			want:   `{"title":"Moana","year":2016,"runtime":107}`,
+		},
+		{
+			name:   "null removes a member",
+			target: `{"title":"Moana","tagline":"The ocean is calling."}`,
+			patch:  `{"tagline":null}`,
+			want:   `{"title":"Moana"}`,
+		},
+		{
+			name:   "null removes a nested member",
+			target: `{"external_ids":{"imdb":"tt3521164","tmdb":"277834"}}`,
+			patch:  `{"external_ids":{"tmdb":null,"wikidata":"Q18647981"}}`,
+			want:   `{"external_ids":{"imdb":"tt3521164","wikidata":"Q18647981"}}`,
+		},
+		{
+			name:   "null for a missing member",
+			target: `{"title":"Moana"}`,
+			patch:  `{"tagline":null}`,
+			want:   `{"title":"Moana"}`,
+		},
+		{
+			name:   "arrays are replaced",
+			target: `{"genres":["animation","family"]}`,
+			patch:  `{"genres":["musical"]}`,
+			want:   `{"genres":["musical"]}`,
+		},
+		{
+			name:   "object replaces a scalar",
+			target: `{"poster":"moana.jpg"}`,
+			patch:  `{"poster":{"original":"moana.jpg","w185":null}}`,
+			want:   `{"poster":{"original":"moana.jpg"}}`,
+		},
+		{
+			name:   "non-object patch replaces the target",
+			target: `{"title":"Moana"}`,
+			patch:  `["Moana"]`,
+			want:   `["Moana"]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Merge(decode(t, tt.target), decode(t, tt.patch))
+			if want := decode(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package storage
+
+import (
+	"context"
+	"io"
+)
+
+// BlobStore is a place to keep binary objects such as movie artwork. Keys are slash
+// separated paths like "posters/42/original.jpg".
+type BlobStore interface {
+	// Put writes size bytes from r under key, replacing any existing object.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Delete removes the object stored under key. Deleting a missing object is not an
+	// error.
+	Delete(ctx context.Context, key string) error
+	// URL returns the address clients can fetch the object from.
+	URL(key string) string
+}
@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// received is a request as seen by the fake S3 server.
+type received struct {
+	method string
+	host   string
+	path   string
+	body   string
+	header http.Header
+}
+
+// newFakeS3 starts a server that checks the signature of every request the way S3 does,
+// records the request and answers with status, or 403 if the signature is wrong. The
+// returned store reaches the server whatever host its requests are addressed to, so
+// virtual-host addressing works without DNS.
+func newFakeS3(t *testing.T, pathStyle bool, status int) (*S3Store, *[]received) {
+	t.Helper()
+	var requests []received
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		requests = append(requests, received{method: r.Method, host: r.Host, path: r.URL.EscapedPath(), body: string(body), header: r.Header})
+		if problem := checkSignature(r, body, "secret"); problem != "" {
+			t.Errorf("%s %s: %s", r.Method, r.URL.Path, problem)
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, "<Error><Code>SignatureDoesNotMatch</Code></Error>")
+			return
+		}
+		w.WriteHeader(status)
+		if status/100 != 2 {
+			io.WriteString(w, "<Error><Code>AccessDenied</Code></Error>\n")
+		}
+	}))
+	t.Cleanup(ts.Close)
+
+	store, err := NewS3Store(ts.URL, "eu-west-1", "posters", "access", "secret", pathStyle, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ts.Listener.Addr().String()
+	store.Client = &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	return store, &requests
+}
+
+var authorizationRX = regexp.MustCompile(`^AWS4-HMAC-SHA256 Credential=([^/]+)/(\d{8})/([^/]+)/s3/aws4_request, SignedHeaders=([a-z0-9;-]+), Signature=([0-9a-f]{64})$`)
+
+// checkSignature verifies the Signature Version 4 of r from what arrived at the
+// server, and returns what is wrong with it, if anything.
+func checkSignature(r *http.Request, body []byte, secretKey string) string {
+	m := authorizationRX.FindStringSubmatch(r.Header.Get("Authorization"))
+	if m == nil {
+		return "malformed Authorization header " + r.Header.Get("Authorization")
+	}
+	accessKey, date, region, signedHeaders, signature := m[1], m[2], m[3], m[4], m[5]
+	if accessKey != "access" || region != "eu-west-1" {
+		return "wrong credential scope " + m[0]
+	}
+	bodyHash := sha256.Sum256(body)
+	if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(bodyHash[:]) {
+		return "X-Amz-Content-Sha256 does not match the body"
+	}
+	amzDate := r.Header.Get("X-Amz-Date")
+	if !strings.HasPrefix(amzDate, date) {
+		return "X-Amz-Date does not match the credential date"
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, name := range strings.Split(signedHeaders, ";") {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	canonicalRequest := r.Method + "\n" + r.URL.EscapedPath() + "\n" + r.URL.RawQuery + "\n" +
+		canonicalHeaders.String() + "\n" + signedHeaders + "\n" + r.Header.Get("X-Amz-Content-Sha256")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + date + "/" + region + "/s3/aws4_request\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{date, region, "s3", "aws4_request", stringToSign} {
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(part))
+		key = h.Sum(nil)
+	}
+	if hex.EncodeToString(key) != signature {
+		return "signature does not match"
+	}
+	return ""
+}
+
+func TestS3StorePut(t *testing.T) {
+	tests := []struct {
+		name      string
+		pathStyle bool
+		host      string
+		path      string
+	}{
+		{name: "path style", pathStyle: true, host: "127.0.0.1", path: "/posters/movies/1/a%20b%2Bc.jpg"},
+		{name: "virtual host", pathStyle: false, host: "posters.127.0.0.1", path: "/movies/1/a%20b%2Bc.jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, requests := newFakeS3(t, tt.pathStyle, http.StatusOK)
+			err := store.Put(context.Background(), "movies/1/a b+c.jpg", strings.NewReader("poster bytes"), 12, "image/jpeg")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(*requests) != 1 {
+				t.Fatalf("got %d requests, want 1", len(*requests))
+			}
+			req := (*requests)[0]
+			if req.method != http.MethodPut || req.path != tt.path || req.body != "poster bytes" {
+				t.Errorf("got %s %s with body %q, want PUT %s with the poster", req.method, req.path, req.body, tt.path)
+			}
+			if host, _, _ := net.SplitHostPort(req.host); host != tt.host {
+				t.Errorf("got host %q, want %q", host, tt.host)
+			}
+			if got := req.header.Get("Content-Type"); got != "image/jpeg" {
+				t.Errorf("got Content-Type %q, want image/jpeg", got)
+			}
+		})
+	}
+}
+
+func TestS3StoreErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		do     func(*S3Store) error
+		err    string
+	}{
+		{
+			name:   "put refused",
+			status: http.StatusForbidden,
+			do: func(s *S3Store) error {
+				return s.Put(context.Background(), "a.jpg", strings.NewReader("x"), 1, "image/jpeg")
+			},
+			err: "s3: PUT /posters/a.jpg: 403 Forbidden: <Error><Code>AccessDenied</Code></Error>",
+		},
+		{
+			name:   "delete failed",
+			status: http.StatusInternalServerError,
+			do:     func(s *S3Store) error { return s.Delete(context.Background(), "a.jpg") },
+			err:    "s3: DELETE /posters/a.jpg: 500 Internal Server Error",
+		},
+		{
+			name:   "delete of a missing object",
+			status: http.StatusNotFound,
+			do:     func(s *S3Store) error { return s.Delete(context.Background(), "a.jpg") },
+		},
+		{
+			name:   "delete",
+			status: http.StatusNoContent,
+			do:     func(s *S3Store) error { return s.Delete(context.Background(), "a.jpg") },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, _ := newFakeS3(t, true, tt.status)
+			err := tt.do(store)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("got error %v, want none", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Fatalf("got error %v, want one starting with %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestS3StoreURL(t *testing.T) {
+	store, err := NewS3Store("https://s3.example.com/", "eu-west-1", "posters", "access", "secret", false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := store.URL("movies/1/a b.jpg"), "https://posters.s3.example.com/movies/1/a%20b.jpg"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	store.PathStyle = true
+	if got, want := store.URL("movies/1/a b.jpg"), "https://s3.example.com/posters/movies/1/a%20b.jpg"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	store.BaseURL = "https://cdn.example.com"
+	if got, want := store.URL("movies/1/a b.jpg"), "https://cdn.example.com/movies/1/a%20b.jpg"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	_, err = NewS3Store("s3.example.com", "eu-west-1", "posters", "", "", false, "")
+	if err == nil {
+		t.Error("got no error for an endpoint without a scheme")
+	}
+}
@@ -0,0 +1,2 @@
+ALTER TABLE movies DROP COLUMN IF EXISTS poster;
+ALTER TABLE movies DROP COLUMN IF EXISTS poster_key;
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS movies_title_key_idx;
+DROP FUNCTION IF EXISTS movie_title_key(text);
+DROP INDEX IF EXISTS movies_external_ids_idx;
+DROP INDEX IF EXISTS movies_external_ids_wikidata_idx;
+DROP INDEX IF EXISTS movies_external_ids_tmdb_idx;
+DROP INDEX IF EXISTS movies_external_ids_imdb_idx;
+ALTER TABLE movies DROP COLUMN IF EXISTS external_ids;
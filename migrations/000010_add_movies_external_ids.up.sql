@@ -0,0 +1,11 @@
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS external_ids jsonb NOT NULL DEFAULT '{}';
+CREATE UNIQUE INDEX IF NOT EXISTS movies_external_ids_imdb_idx ON movies ((external_ids->>'imdb')) WHERE external_ids ? 'imdb';
+CREATE UNIQUE INDEX IF NOT EXISTS movies_external_ids_tmdb_idx ON movies ((external_ids->>'tmdb')) WHERE external_ids ? 'tmdb';
+CREATE UNIQUE INDEX IF NOT EXISTS movies_external_ids_wikidata_idx ON movies ((external_ids->>'wikidata')) WHERE external_ids ? 'wikidata';
+CREATE INDEX IF NOT EXISTS movies_external_ids_idx ON movies USING GIN (external_ids jsonb_path_ops);
+
+-- Keep in step with data.NormalizeTitle.
+CREATE OR REPLACE FUNCTION movie_title_key(title text) RETURNS text AS $$
+    SELECT regexp_replace(regexp_replace(lower(title), '^(the|a|an)\s+', ''), '[^[:alnum:]]+', '', 'g')
+$$ LANGUAGE sql IMMUTABLE PARALLEL SAFE;
+CREATE INDEX IF NOT EXISTS movies_title_key_idx ON movies (movie_title_key(title));
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS movie_redirects (
+    old_id bigint PRIMARY KEY,
+    new_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS movie_redirects_new_id_idx ON movie_redirects (new_id);
@@ -0,0 +1,2 @@
+DROP FUNCTION IF EXISTS title_tokens(text);
+DROP FUNCTION IF EXISTS array_jaccard(text[], text[]);
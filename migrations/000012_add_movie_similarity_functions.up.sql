@@ -0,0 +1,12 @@
+-- Jaccard similarity of two arrays treated as sets, 0 when both are empty.
+CREATE OR REPLACE FUNCTION array_jaccard(a text[], b text[]) RETURNS double precision AS $$
+    SELECT coalesce(
+        (SELECT count(*) FROM (SELECT unnest(a) INTERSECT SELECT unnest(b)) AS i)::double precision /
+        nullif((SELECT count(*) FROM (SELECT unnest(a) UNION SELECT unnest(b)) AS u), 0),
+        0)
+$$ LANGUAGE sql IMMUTABLE PARALLEL SAFE;
+
+-- Lower cased words of a title, used for title overlap.
+CREATE OR REPLACE FUNCTION title_tokens(title text) RETURNS text[] AS $$
+    SELECT array_remove(regexp_split_to_array(lower(title), '[^[:alnum:]]+'), '')
+$$ LANGUAGE sql IMMUTABLE PARALLEL SAFE;
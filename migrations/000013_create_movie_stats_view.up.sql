@@ -0,0 +1,22 @@
+CREATE MATERIALIZED VIEW IF NOT EXISTS movie_stats AS
+WITH live AS (
+    SELECT * FROM movies WHERE deleted_at IS NULL
+)
+SELECT
+    1 AS id,
+    NOW() AS refreshed_at,
+    (SELECT count(*) FROM live) AS total_movies,
+    (SELECT count(DISTINCT genre) FROM live, unnest(genres) AS genre) AS total_genres,
+    (SELECT coalesce(avg(runtime), 0)::double precision FROM live) AS average_runtime,
+    (SELECT coalesce(jsonb_agg(jsonb_build_object('genre', genre, 'count', n) ORDER BY n DESC, genre), '[]')
+     FROM (SELECT genre, count(*) AS n FROM live, unnest(genres) AS genre GROUP BY genre) AS g) AS by_genre,
+    (SELECT coalesce(jsonb_agg(jsonb_build_object('decade', decade, 'count', n, 'average_runtime', avg_runtime) ORDER BY decade), '[]')
+     FROM (SELECT year / 10 * 10 AS decade, count(*) AS n, round(avg(runtime), 1)::double precision AS avg_runtime
+           FROM live GROUP BY year / 10 * 10) AS d) AS by_decade,
+    (SELECT coalesce(jsonb_agg(jsonb_build_object('from', lower_bound, 'to', lower_bound + 29, 'count', n) ORDER BY lower_bound), '[]')
+     FROM (SELECT runtime / 30 * 30 AS lower_bound, count(*) AS n FROM live GROUP BY runtime / 30 * 30) AS r) AS runtime_histogram,
+    (SELECT coalesce(jsonb_agg(jsonb_build_object('week', to_char(week, 'YYYY-MM-DD'), 'count', n) ORDER BY week), '[]')
+     FROM (SELECT date_trunc('week', created_at) AS week, count(*) AS n FROM live GROUP BY 1) AS w) AS added_per_week;
+
+-- REFRESH MATERIALIZED VIEW CONCURRENTLY needs a unique index.
+CREATE UNIQUE INDEX IF NOT EXISTS movie_stats_id_idx ON movie_stats (id);
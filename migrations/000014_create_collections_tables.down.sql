@@ -0,0 +1,3 @@
+DROP FUNCTION IF EXISTS movie_collection(bigint);
+DROP TABLE IF EXISTS collection_movies;
+DROP TABLE IF EXISTS collections;
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS collections (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    description text NOT NULL DEFAULT '',
+    version integer NOT NULL DEFAULT 1
+);
+
+-- A movie belongs to at most one collection.
+CREATE TABLE IF NOT EXISTS collection_movies (
+    collection_id bigint NOT NULL REFERENCES collections ON DELETE CASCADE,
+    movie_id bigint NOT NULL UNIQUE REFERENCES movies ON DELETE CASCADE,
+    position integer NOT NULL CHECK (position > 0),
+    PRIMARY KEY (collection_id, movie_id),
+    UNIQUE (collection_id, position)
+);
+
+CREATE INDEX IF NOT EXISTS collections_name_idx ON collections USING GIN (to_tsvector('simple', name));
+
+-- movie_collection describes the collection a movie belongs to, or returns NULL if it
+-- isn't in one.
+CREATE OR REPLACE FUNCTION movie_collection(movie_id bigint) RETURNS jsonb
+LANGUAGE sql STABLE AS $$
+    SELECT jsonb_build_object('id', collections.id, 'name', collections.name, 'position', collection_movies.position)
+    FROM collection_movies
+    INNER JOIN collections ON collections.id = collection_movies.collection_id
+    WHERE collection_movies.movie_id = $1
+$$;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS movie_translations;
+DROP FUNCTION IF EXISTS locale_ts_config(text);
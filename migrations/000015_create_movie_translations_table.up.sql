@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS movie_translations (
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    locale text NOT NULL,
+    title text NOT NULL,
+    synopsis text NOT NULL DEFAULT '',
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (movie_id, locale)
+);
+
+-- locale_ts_config picks the text search configuration for the language of a locale,
+-- so that translated titles are stemmed the way their language needs.
+CREATE OR REPLACE FUNCTION locale_ts_config(locale text) RETURNS regconfig
+LANGUAGE sql IMMUTABLE AS $$
+    SELECT (CASE split_part(lower(locale), '-', 1)
+        WHEN 'da' THEN 'danish'
+        WHEN 'de' THEN 'german'
+        WHEN 'en' THEN 'english'
+        WHEN 'es' THEN 'spanish'
+        WHEN 'fi' THEN 'finnish'
+        WHEN 'fr' THEN 'french'
+        WHEN 'hu' THEN 'hungarian'
+        WHEN 'it' THEN 'italian'
+        WHEN 'nb' THEN 'norwegian'
+        WHEN 'nl' THEN 'dutch'
+        WHEN 'no' THEN 'norwegian'
+        WHEN 'pt' THEN 'portuguese'
+        WHEN 'ro' THEN 'romanian'
+        WHEN 'ru' THEN 'russian'
+        WHEN 'sv' THEN 'swedish'
+        WHEN 'tr' THEN 'turkish'
+        ELSE 'simple'
+    END)::regconfig
+$$;
+
+CREATE INDEX IF NOT EXISTS movie_translations_title_idx ON movie_translations USING GIN (to_tsvector(locale_ts_config(locale), title));
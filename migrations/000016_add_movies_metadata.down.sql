@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS movies_certifications_idx;
+DROP INDEX IF EXISTS movies_original_language_idx;
+ALTER TABLE movies DROP COLUMN IF EXISTS certifications;
+ALTER TABLE movies DROP COLUMN IF EXISTS release_dates;
+ALTER TABLE movies DROP COLUMN IF EXISTS original_language;
+ALTER TABLE movies DROP COLUMN IF EXISTS synopsis;
+ALTER TABLE movies DROP COLUMN IF EXISTS tagline;
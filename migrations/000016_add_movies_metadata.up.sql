@@ -0,0 +1,16 @@
+-- The defaults describe a movie we know nothing more about, so existing rows pass the
+-- new checks as they are.
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS tagline text NOT NULL DEFAULT '';
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS synopsis text NOT NULL DEFAULT '';
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS original_language text NOT NULL DEFAULT '';
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS release_dates jsonb NOT NULL DEFAULT '{}';
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS certifications jsonb NOT NULL DEFAULT '{}';
+
+ALTER TABLE movies ADD CONSTRAINT movies_tagline_check CHECK (length(tagline) <= 300);
+ALTER TABLE movies ADD CONSTRAINT movies_synopsis_check CHECK (length(synopsis) <= 5000);
+ALTER TABLE movies ADD CONSTRAINT movies_original_language_check CHECK (original_language ~ '^([a-z]{2,3})?$');
+ALTER TABLE movies ADD CONSTRAINT movies_release_dates_check CHECK (jsonb_typeof(release_dates) = 'object');
+ALTER TABLE movies ADD CONSTRAINT movies_certifications_check CHECK (jsonb_typeof(certifications) = 'object');
+
+CREATE INDEX IF NOT EXISTS movies_original_language_idx ON movies (original_language) WHERE original_language <> '';
+CREATE INDEX IF NOT EXISTS movies_certifications_idx ON movies USING GIN (certifications);
@@ -0,0 +1,6 @@
+ALTER TABLE movie_revisions DROP COLUMN IF EXISTS certifications;
+ALTER TABLE movie_revisions DROP COLUMN IF EXISTS release_dates;
+ALTER TABLE movie_revisions DROP COLUMN IF EXISTS external_ids;
+ALTER TABLE movie_revisions DROP COLUMN IF EXISTS original_language;
+ALTER TABLE movie_revisions DROP COLUMN IF EXISTS synopsis;
+ALTER TABLE movie_revisions DROP COLUMN IF EXISTS tagline;
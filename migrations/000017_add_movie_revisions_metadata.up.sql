@@ -0,0 +1,14 @@
+ALTER TABLE movie_revisions ADD COLUMN IF NOT EXISTS tagline text NOT NULL DEFAULT '';
+ALTER TABLE movie_revisions ADD COLUMN IF NOT EXISTS synopsis text NOT NULL DEFAULT '';
+ALTER TABLE movie_revisions ADD COLUMN IF NOT EXISTS original_language text NOT NULL DEFAULT '';
+ALTER TABLE movie_revisions ADD COLUMN IF NOT EXISTS external_ids jsonb NOT NULL DEFAULT '{}';
+ALTER TABLE movie_revisions ADD COLUMN IF NOT EXISTS release_dates jsonb NOT NULL DEFAULT '{}';
+ALTER TABLE movie_revisions ADD COLUMN IF NOT EXISTS certifications jsonb NOT NULL DEFAULT '{}';
+
+-- Only the current version of each movie is known to hold its metadata. Earlier
+-- revisions keep the defaults.
+UPDATE movie_revisions
+SET tagline = movies.tagline, synopsis = movies.synopsis, original_language = movies.original_language,
+    external_ids = movies.external_ids, release_dates = movies.release_dates, certifications = movies.certifications
+FROM movies
+WHERE movie_revisions.movie_id = movies.id AND movie_revisions.version = movies.version;
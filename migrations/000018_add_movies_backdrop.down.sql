@@ -0,0 +1,2 @@
+ALTER TABLE movies DROP COLUMN IF EXISTS backdrop;
+ALTER TABLE movies DROP COLUMN IF EXISTS backdrop_key;
@@ -0,0 +1,2 @@
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS backdrop_key text;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS backdrop jsonb;
@@ -0,0 +1,10 @@
+// Package migrations embeds the SQL migrations of the database schema, so that the
+// api binary can apply them without a copy of this directory.
+package migrations
+
+import "embed"
+
+// FS holds the migration files, named like 000001_create_movies_table.up.sql.
+//
+//go:embed *.sql
+var FS embed.FS